@@ -0,0 +1,475 @@
+package gojq
+
+import (
+	"maps"
+	"reflect"
+	"strings"
+)
+
+// An accumulatorUpdate is an update of the accumulator of reduce and foreach
+// syntax, which can be applied in place. The path is nil for `. + value`.
+type accumulatorUpdate struct {
+	path  *Query
+	op    Operator // OpAssign, OpModify, or OpUpdateAdd to OpUpdateMod
+	value *Query
+	// evaluates the path before the value, for `path |= . + value`
+	pathFirst bool
+}
+
+// Returns the updates of the accumulator if the query is a pipeline of the
+// updates which do not leak the references to the accumulator. The updated
+// values are not shared with other values, so we can update them in place
+// instead of copying the entire accumulator on each iteration. The value of
+// `=` and arithmetic update-assignment operators should not depend on the
+// accumulator, and all the values and paths should emit exactly one value.
+func (c *compiler) accumulatorUpdates(e *Query, us []*accumulatorUpdate) ([]*accumulatorUpdate, bool) {
+	if e.FuncDefs != nil {
+		return nil, false
+	}
+	if e.Term != nil {
+		if e.Term.Type == TermTypeQuery && e.Term.SuffixList == nil {
+			return c.accumulatorUpdates(e.Term.Query, us)
+		}
+		return nil, false
+	}
+	switch e.Op {
+	case OpPipe:
+		if e.Patterns != nil {
+			return nil, false
+		}
+		us, ok := c.accumulatorUpdates(e.Left, us)
+		if !ok {
+			return nil, false
+		}
+		return c.accumulatorUpdates(e.Right, us)
+	case OpAdd:
+		if t := e.Left.Term; t == nil || t.Type != TermTypeIdentity || t.SuffixList != nil ||
+			!c.isIndependent(e.Right) || !c.isSingle(e.Right) {
+			return nil, false
+		}
+		return append(us, &accumulatorUpdate{nil, OpUpdateAdd, e.Right, false}), true
+	case OpAssign, OpUpdateAdd, OpUpdateSub, OpUpdateMul, OpUpdateDiv, OpUpdateMod:
+		if !c.isAccumulatorPath(e.Left) ||
+			!c.isIndependent(e.Right) || !c.isSingle(e.Right) {
+			return nil, false
+		}
+		return append(us, &accumulatorUpdate{e.Left, e.Op, e.Right, false}), true
+	case OpModify:
+		if !c.isAccumulatorPath(e.Left) {
+			return nil, false
+		}
+		// optimize `p |= . + f` to append to the value in place
+		if r := e.Right; r.Op == OpAdd && r.Term == nil {
+			if t := r.Left.Term; t != nil && t.Type == TermTypeIdentity && t.SuffixList == nil &&
+				c.isIndependent(r.Right) && c.isSingle(r.Right) {
+				return append(us, &accumulatorUpdate{e.Left, OpUpdateAdd, r.Right, true}), true
+			}
+		}
+		if !c.isSingle(e.Right) {
+			return nil, false
+		}
+		return append(us, &accumulatorUpdate{e.Left, OpModify, e.Right, false}), true
+	default:
+		return nil, false
+	}
+}
+
+// Reports whether the query is a path of indexing, like .a[0].[$x].
+func (c *compiler) isAccumulatorPath(e *Query) bool {
+	if e.FuncDefs != nil || e.Term == nil {
+		return false
+	}
+	switch e.Term.Type {
+	case TermTypeIdentity:
+	case TermTypeIndex:
+		if e.Term.Index.IsSlice || !c.isSingleIndex(e.Term.Index) {
+			return false
+		}
+	default:
+		return false
+	}
+	for _, s := range e.Term.SuffixList {
+		if s.Index == nil || s.Index.IsSlice || s.Iter || s.Optional ||
+			!c.isSingleIndex(s.Index) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *compiler) isSingleIndex(e *Index) bool {
+	if e.IsSlice {
+		return (e.Start == nil || c.isSingle(e.Start)) &&
+			(e.End == nil || c.isSingle(e.End))
+	}
+	if e.Name != "" {
+		return true
+	}
+	if e.Str != nil {
+		return c.isSingleString(e.Str)
+	}
+	return e.Start != nil && c.isSingle(e.Start)
+}
+
+// Reports whether the query emits exactly one value, or an error.
+func (c *compiler) isSingle(e *Query) bool {
+	if e.FuncDefs != nil {
+		return false
+	}
+	if e.Term != nil {
+		return c.isSingleTerm(e.Term)
+	}
+	switch e.Op {
+	case OpPipe:
+		if e.Patterns != nil {
+			return false
+		}
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpEq, OpNe,
+		OpGt, OpLt, OpGe, OpLe, OpAnd, OpOr, OpAlt:
+	default:
+		return false
+	}
+	return c.isSingle(e.Left) && c.isSingle(e.Right)
+}
+
+func (c *compiler) isSingleTerm(e *Term) bool {
+	for _, s := range e.SuffixList {
+		if s.Index == nil || s.Iter || s.Optional || !c.isSingleIndex(s.Index) {
+			return false
+		}
+	}
+	switch e.Type {
+	case TermTypeIdentity, TermTypeNull, TermTypeTrue, TermTypeFalse,
+		TermTypeNumber, TermTypeArray:
+		return true
+	case TermTypeIndex:
+		return c.isSingleIndex(e.Index)
+	case TermTypeFunc:
+		return c.isSingleFunc(e.Func)
+	case TermTypeObject:
+		for _, kv := range e.Object.KeyVals {
+			if kv.KeyString != nil && !c.isSingleString(kv.KeyString) ||
+				kv.KeyQuery != nil && !c.isSingle(kv.KeyQuery) ||
+				kv.Val != nil && !c.isSingle(kv.Val) {
+				return false
+			}
+		}
+		return true
+	case TermTypeUnary:
+		return c.isSingleTerm(e.Unary.Term)
+	case TermTypeFormat:
+		return e.Str == nil || c.isSingleString(e.Str)
+	case TermTypeString:
+		return c.isSingleString(e.Str)
+	case TermTypeIf:
+		if !c.isSingle(e.If.Cond) || !c.isSingle(e.If.Then) ||
+			e.If.Else != nil && !c.isSingle(e.If.Else) {
+			return false
+		}
+		for _, elif := range e.If.Elif {
+			if !c.isSingle(elif.Cond) || !c.isSingle(elif.Then) {
+				return false
+			}
+		}
+		return true
+	case TermTypeQuery:
+		return c.isSingle(e.Query)
+	default:
+		return false
+	}
+}
+
+func (c *compiler) isSingleString(e *String) bool {
+	for _, q := range e.Queries {
+		if !c.isSingle(q) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether the function is a variable or an internal function which
+// emits exactly one value, and is not shadowed by other functions.
+func (c *compiler) isSingleFunc(e *Func) bool {
+	if e.Name[0] == '$' {
+		return true
+	}
+	if len(e.Args) == 0 {
+		if f, v := c.lookupFuncOrVariable(e.Name); f != nil || v != nil {
+			return false
+		}
+	} else {
+		for _, s := range c.scopes {
+			for _, f := range s.funcs {
+				if f.name == e.Name && f.argcnt == len(e.Args) {
+					return false
+				}
+			}
+		}
+	}
+	for _, fd := range builtinFuncDefs[e.Name] {
+		if len(fd.Args) == len(e.Args) {
+			return false
+		}
+	}
+	fn, ok := internalFuncs[e.Name]
+	if !ok || !fn.accept(len(e.Args)) || fn.iter || fn.callback == nil {
+		return false
+	}
+	for _, arg := range e.Args {
+		if !c.isSingle(arg) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether the query does not refer to the input value.
+func (c *compiler) isIndependent(e *Query) bool {
+	if e.FuncDefs != nil {
+		return false
+	}
+	if e.Term != nil {
+		return c.isIndependentTerm(e.Term)
+	}
+	switch e.Op {
+	case OpPipe:
+		return e.Patterns == nil && c.isIndependent(e.Left)
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpEq, OpNe,
+		OpGt, OpLt, OpGe, OpLe, OpAnd, OpOr, OpAlt:
+		return c.isIndependent(e.Left) && c.isIndependent(e.Right)
+	default:
+		return false
+	}
+}
+
+func (c *compiler) isIndependentTerm(e *Term) bool {
+	// the index queries are evaluated against the input of the term
+	for _, s := range e.SuffixList {
+		if s.Index != nil && !c.isIndependentIndex(s.Index) {
+			return false
+		}
+	}
+	switch e.Type {
+	case TermTypeNull, TermTypeTrue, TermTypeFalse, TermTypeNumber:
+		return true
+	case TermTypeFunc:
+		return e.Func.Name[0] == '$'
+	case TermTypeObject:
+		for _, kv := range e.Object.KeyVals {
+			if kv.Val == nil {
+				if kv.Key == "" || kv.Key[0] != '$' {
+					return false
+				}
+			} else if !c.isIndependent(kv.Val) ||
+				kv.KeyString != nil && !c.isIndependentString(kv.KeyString) ||
+				kv.KeyQuery != nil && !c.isIndependent(kv.KeyQuery) {
+				return false
+			}
+		}
+		return true
+	case TermTypeArray:
+		return e.Array.Query == nil || c.isIndependent(e.Array.Query)
+	case TermTypeUnary:
+		return c.isIndependentTerm(e.Unary.Term)
+	case TermTypeFormat:
+		return e.Str != nil && c.isIndependentString(e.Str)
+	case TermTypeString:
+		return c.isIndependentString(e.Str)
+	case TermTypeIf:
+		if !c.isIndependent(e.If.Cond) || !c.isIndependent(e.If.Then) ||
+			e.If.Else == nil || !c.isIndependent(e.If.Else) {
+			return false
+		}
+		for _, elif := range e.If.Elif {
+			if !c.isIndependent(elif.Cond) || !c.isIndependent(elif.Then) {
+				return false
+			}
+		}
+		return true
+	case TermTypeQuery:
+		return c.isIndependent(e.Query)
+	default:
+		return false
+	}
+}
+
+func (c *compiler) isIndependentIndex(e *Index) bool {
+	return (e.Str == nil || c.isIndependentString(e.Str)) &&
+		(e.Start == nil || c.isIndependent(e.Start)) &&
+		(e.End == nil || c.isIndependent(e.End))
+}
+
+func (c *compiler) isIndependentString(e *String) bool {
+	for _, q := range e.Queries {
+		if !c.isIndependent(q) {
+			return false
+		}
+	}
+	return true
+}
+
+// Appends the compiled code for the updates of the accumulator, which are
+// applied in place using the allocator stored in the variable a. The code
+// evaluates the paths and values in the same order as the update operators.
+func (c *compiler) compileAccumulatorUpdates(us []*accumulatorUpdate, a [2]int) error {
+	for _, u := range us {
+		v, x, p := c.newVariable(), c.newVariable(), c.newVariable()
+		c.append(&code{op: opstore, v: v})
+		if u.path == nil { // . + f
+			c.append(&code{op: opload, v: a})
+			c.append(&code{op: opload, v: v})
+			if err := c.compileQuery(u.value); err != nil {
+				return err
+			}
+			c.append(&code{op: opload, v: v})
+			c.append(&code{op: opcall, v: [3]any{funcUpdateWithAllocator(u.op), 2, "_update"}})
+			continue
+		}
+		if u.op != OpModify && !u.pathFirst {
+			c.append(&code{op: opload, v: v})
+			if u.op == OpAssign { // ref: compileAssign
+				c.append(&code{op: opexpbegin})
+			}
+			if err := c.compileQuery(u.value); err != nil {
+				return err
+			}
+			c.append(&code{op: opstore, v: x})
+			if u.op == OpAssign {
+				c.append(&code{op: opexpend})
+			}
+		}
+		if xs := u.path.toIndices(nil); xs != nil && u.op == OpAssign {
+			c.append(&code{op: oppush, v: xs})
+		} else {
+			c.append(&code{op: opload, v: v})
+			c.append(&code{op: oppathbegin})
+			if err := c.compileQuery(u.path); err != nil {
+				return err
+			}
+			c.append(&code{op: opload, v: v})
+			c.append(&code{op: oppathend})
+		}
+		c.append(&code{op: opstore, v: p})
+		c.append(&code{op: opload, v: a})
+		switch {
+		case u.op == OpAssign:
+			c.append(&code{op: opload, v: x})
+		case u.op == OpModify: // ref: compileModify
+			c.appends(
+				&code{op: opload, v: p},
+				&code{op: opload, v: v},
+				&code{op: opcall, v: [3]any{internalFuncs["getpath"].callback, 1, "getpath"}},
+			)
+			if err := c.compileQuery(u.value); err != nil {
+				return err
+			}
+		default: // p op= f, p |= . + f
+			c.append(&code{op: opload, v: a})
+			if !u.pathFirst {
+				c.append(&code{op: opload, v: x})
+			}
+			c.appends(
+				&code{op: opload, v: p},
+				&code{op: opload, v: v},
+				&code{op: opcall, v: [3]any{internalFuncs["getpath"].callback, 1, "getpath"}},
+			)
+			if u.pathFirst {
+				c.append(&code{op: opstore, v: x})
+				c.append(&code{op: opload, v: x})
+				if err := c.compileQuery(u.value); err != nil {
+					return err
+				}
+				c.append(&code{op: opload, v: x})
+			}
+			c.append(&code{op: opcall, v: [3]any{funcUpdateWithAllocator(u.op), 2, "_update"}})
+		}
+		c.appends(
+			&code{op: opload, v: p},
+			&code{op: opload, v: v},
+			&code{op: opcall, v: [3]any{funcSetpathWithAllocator, 3, "_setpath"}},
+		)
+	}
+	return nil
+}
+
+// Used in compiler#compileAccumulatorUpdates for the arithmetic operators of
+// the updates, like `p += f` and `. + f`.
+func funcUpdateWithAllocator(op Operator) func(any, []any) any {
+	return func(v any, args []any) any {
+		a := args[1].(allocator)
+		var u any
+		switch op {
+		case OpUpdateAdd:
+			u = a.add(v, args[0])
+		case OpUpdateSub:
+			u = funcOpSub(nil, v, args[0])
+		case OpUpdateMul:
+			u = funcOpMul(nil, v, args[0])
+		case OpUpdateDiv:
+			u = funcOpDiv(nil, v, args[0])
+		default:
+			u = funcOpMod(nil, v, args[0])
+		}
+		if _, ok := u.(error); !ok {
+			a.release(v, u)
+		}
+		return u
+	}
+}
+
+// Returns l + r, appending to the allocated array or string, and merging into
+// the allocated object in place. The arrays and strings are allocated with
+// extra capacity, so that the successive additions run in amortized constant
+// time with respect to the size of the left-hand side.
+func (a allocator) add(l, r any) any {
+	switch l := l.(type) {
+	case []any:
+		if r, ok := r.([]any); ok && len(l) > 0 && len(r) > 0 {
+			if a.allocated(l) {
+				if len(l)+len(r) <= cap(l) {
+					return append(l, r...)
+				}
+				delete(a, reflect.ValueOf(l).Pointer())
+			}
+			v := a.makeArray(len(l)+len(r), (len(l)+len(r))*2)
+			copy(v, l)
+			copy(v[len(l):], r)
+			return v
+		}
+	case map[string]any:
+		if r, ok := r.(map[string]any); ok && len(l) > 0 && len(r) > 0 {
+			if !a.allocated(l) {
+				v := a.makeObject(len(l) + len(r))
+				maps.Copy(v, l)
+				maps.Copy(v, r)
+				return v
+			}
+			for k, v := range r {
+				if x, ok := l[k]; ok {
+					a.disown(x)
+				}
+				l[k] = v
+			}
+			return l
+		}
+	case string:
+		if r, ok := r.(string); ok && len(l) > 0 && len(r) > 0 {
+			// the builder never modifies the bytes of the strings it has built
+			p := reflect.ValueOf(l).Pointer()
+			sb := a[p]
+			if sb != nil && sb.Len() == len(l) {
+				delete(a, p)
+			} else {
+				sb = &strings.Builder{}
+				sb.Grow((len(l) + len(r)) * 2)
+				sb.WriteString(l)
+			}
+			sb.WriteString(r)
+			s := sb.String()
+			a[reflect.ValueOf(s).Pointer()] = sb
+			return s
+		}
+	}
+	return funcOpAdd(nil, l, r)
+}
@@ -0,0 +1,163 @@
+package gojq
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// Cache is a cache of compiled queries, which is safe for concurrent use by
+// multiple goroutines. The cache holds at most the given number of compiled
+// codes, and evicts the least recently used one. Use [NewCache] to create one.
+//
+// The compiled codes are keyed by the query text and the compiler options. The
+// variable names are compared by the values, while the module loader, input
+// iterator, random source, and regular expression engine are compared by the
+// identity, so reuse the same values to hit the cache. The queries compiled
+// with the options of functions ([WithEnvironLoader], [WithFunction], and
+// [WithIterFunction]) are not cached, since functions are not comparable.
+// When multiple goroutines compile the same query with the same options at
+// the same time, the query is compiled only once.
+type Cache struct {
+	size     int
+	mu       sync.Mutex
+	entries  map[string][]*list.Element
+	list     *list.List
+	inflight map[string][]*cacheCall
+	hits     uint64
+	misses   uint64
+}
+
+// CacheStats is the statistics of [Cache].
+type CacheStats struct {
+	Hits   uint64 // number of compilations served from the cache
+	Misses uint64 // number of compilations not served from the cache
+	Len    int    // number of compiled codes in the cache
+}
+
+type cacheEntry struct {
+	src     string
+	options *compiler
+	code    *Code
+}
+
+type cacheCall struct {
+	options *compiler
+	done    chan struct{}
+	code    *Code
+	err     error
+}
+
+// NewCache creates a new [Cache] holding at most size compiled codes. It panics
+// if the size is not positive.
+func NewCache(size int) *Cache {
+	if size < 1 {
+		panic(fmt.Sprintf("invalid cache size: %d", size))
+	}
+	return &Cache{
+		size:     size,
+		entries:  make(map[string][]*list.Element),
+		list:     list.New(),
+		inflight: make(map[string][]*cacheCall),
+	}
+}
+
+// Compile parses and compiles the query with the compiler options, or returns
+// the cached compiled code. The parse and compile errors are not cached, but
+// shared with the goroutines waiting for the same query.
+func (c *Cache) Compile(src string, options ...CompilerOption) (*Code, error) {
+	opts := &compiler{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	c.mu.Lock()
+	if opts.environLoader != nil || len(opts.customFuncs) > 0 {
+		c.misses++
+		c.mu.Unlock()
+		return compileSource(src, options)
+	}
+	for _, e := range c.entries[src] {
+		if entry := e.Value.(*cacheEntry); sameCompilerOptions(entry.options, opts) {
+			c.list.MoveToFront(e)
+			c.hits++
+			c.mu.Unlock()
+			return entry.code, nil
+		}
+	}
+	for _, call := range c.inflight[src] {
+		if sameCompilerOptions(call.options, opts) {
+			c.hits++
+			c.mu.Unlock()
+			<-call.done
+			return call.code, call.err
+		}
+	}
+	call := &cacheCall{options: opts, done: make(chan struct{})}
+	c.inflight[src] = append(c.inflight[src], call)
+	c.misses++
+	c.mu.Unlock()
+
+	call.code, call.err = compileSource(src, options)
+
+	c.mu.Lock()
+	c.inflight[src] = deleteElement(c.inflight[src], call)
+	if len(c.inflight[src]) == 0 {
+		delete(c.inflight, src)
+	}
+	if call.err == nil {
+		e := c.list.PushFront(&cacheEntry{src, opts, call.code})
+		c.entries[src] = append(c.entries[src], e)
+		if c.list.Len() > c.size {
+			e := c.list.Back()
+			c.list.Remove(e)
+			src := e.Value.(*cacheEntry).src
+			if c.entries[src] = deleteElement(c.entries[src], e); len(c.entries[src]) == 0 {
+				delete(c.entries, src)
+			}
+		}
+	}
+	c.mu.Unlock()
+	close(call.done)
+	return call.code, call.err
+}
+
+func compileSource(src string, options []CompilerOption) (*Code, error) {
+	q, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(q, options...)
+}
+
+func deleteElement[T comparable](xs []T, x T) []T {
+	return slices.DeleteFunc(xs, func(y T) bool { return y == x })
+}
+
+// sameCompilerOptions reports whether the compilers are configured with the
+// same compiler options, except for the options of functions.
+func sameCompilerOptions(c, d *compiler) bool {
+	return sameValue(c.moduleLoader, d.moduleLoader) &&
+		slices.Equal(c.variables, d.variables) &&
+		sameValue(c.inputIter, d.inputIter) &&
+		sameValue(c.randSource, d.randSource) &&
+		sameValue(c.regexpEngine, d.regexpEngine)
+}
+
+// sameValue reports whether the values are identical. The values of types
+// which are not comparable are never identical.
+func sameValue(x, y any) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	v, w := reflect.ValueOf(x), reflect.ValueOf(y)
+	return v.Type() == w.Type() && v.Comparable() && w.Comparable() && x == y
+}
+
+// Stats returns the statistics of the cache.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Len: c.list.Len()}
+}
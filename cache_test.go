@@ -0,0 +1,180 @@
+package gojq_test
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func ExampleCache() {
+	cache := gojq.NewCache(100)
+	for _, input := range []any{
+		map[string]any{"foo": []any{1, 2}},
+		map[string]any{"foo": []any{3, 4}},
+	} {
+		code, err := cache.Compile(".foo | add")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		iter := code.Run(input)
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				log.Fatalln(err)
+			}
+			fmt.Printf("%#v\n", v)
+		}
+	}
+	fmt.Printf("%+v\n", cache.Stats())
+
+	// Output:
+	// 3
+	// 7
+	// {Hits:1 Misses:1 Len:1}
+}
+
+func TestCacheEviction(t *testing.T) {
+	cache := gojq.NewCache(2)
+	for _, src := range []string{"1", "2", "1", "3", "1", "2"} {
+		if _, err := cache.Compile(src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, expected := cache.Stats(), (gojq.CacheStats{
+		Hits: 2, Misses: 4, Len: 2,
+	}); got != expected {
+		t.Errorf("expected: %+v, got: %+v", expected, got)
+	}
+}
+
+func TestCacheError(t *testing.T) {
+	cache := gojq.NewCache(10)
+	option := gojq.WithVariables([]string{"$x"})
+	for _, src := range []string{"$x | .[", "$y"} {
+		if _, err := cache.Compile(src, option); err == nil {
+			t.Errorf("expected: error, got: nil")
+		}
+	}
+	if _, err := cache.Compile("$x", option); err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := cache.Stats(), (gojq.CacheStats{
+		Hits: 0, Misses: 3, Len: 1,
+	}); got != expected {
+		t.Errorf("expected: %+v, got: %+v", expected, got)
+	}
+	if _, err := cache.Compile("$y", option); err == nil {
+		t.Errorf("expected: error, got: nil")
+	}
+}
+
+func TestCacheCompilerOptions(t *testing.T) {
+	cache := gojq.NewCache(10)
+	f := func(any, []any) any { return 1 }
+	g := func(any, []any) any { return 2 }
+	option := gojq.WithFunction("f", 0, 0, f)
+	for _, tc := range []struct {
+		option   gojq.CompilerOption
+		expected any
+	}{
+		{option, 1},
+		{gojq.WithFunction("f", 0, 0, f), 1},
+		{gojq.WithFunction("f", 0, 0, g), 2},
+		{option, 1},
+	} {
+		code, err := cache.Compile("f", tc.option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := code.Run(nil).Next(); got != tc.expected {
+			t.Errorf("expected: %v, got: %v", tc.expected, got)
+		}
+	}
+	for range 2 {
+		code, err := cache.Compile("$x", gojq.WithVariables([]string{"$x"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := code.Run(nil, 3).Next(); got != 3 {
+			t.Errorf("expected: %v, got: %v", 3, got)
+		}
+	}
+	if _, err := cache.Compile("$x"); err == nil {
+		t.Errorf("expected: error, got: nil")
+	}
+	if got, expected := cache.Stats(), (gojq.CacheStats{
+		Hits: 1, Misses: 6, Len: 1,
+	}); got != expected {
+		t.Errorf("expected: %+v, got: %+v", expected, got)
+	}
+}
+
+func TestCacheGoroutines(t *testing.T) {
+	cache := gojq.NewCache(10)
+	codes := make([]*gojq.Code, 100)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, err := cache.Compile(`[.[] | tostring | test("1")] | any`)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			codes[i] = code
+		}()
+	}
+	wg.Wait()
+	for _, code := range codes {
+		if code != codes[0] {
+			t.Fatalf("expected the same code: %p, %p", codes[0], code)
+		}
+	}
+	if got, expected := cache.Stats(), (gojq.CacheStats{
+		Hits: 99, Misses: 1, Len: 1,
+	}); got != expected {
+		t.Errorf("expected: %+v, got: %+v", expected, got)
+	}
+	iter := codes[0].Run([]any{0, 10})
+	if v, ok := iter.Next(); !ok || v != true {
+		t.Errorf("expected: true, got: %v", v)
+	}
+}
+
+func TestCompileGoroutines(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			query, err := gojq.Parse(fmt.Sprintf("[range(%d) | tostring] | join(\",\")", i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			code, err := gojq.Compile(query)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			expected := ""
+			for j := range i {
+				if j > 0 {
+					expected += ","
+				}
+				expected += fmt.Sprint(j)
+			}
+			if v, _ := code.Run(nil).Next(); v != expected {
+				t.Errorf("expected: %v, got: %v", expected, v)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -2,12 +2,19 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/mattn/go-isatty"
 
@@ -45,6 +52,8 @@ type cli struct {
 	inputStream   bool
 	inputYAML     bool
 	inputSlurp    bool
+	inputLazy     bool
+	parallel      int
 
 	argnames  []string
 	argvalues []any
@@ -68,14 +77,19 @@ type flagopts struct {
 	InputStream   bool              `long:"stream" description:"parse input in stream fashion"`
 	InputYAML     bool              `long:"yaml-input" description:"read input as YAML format"`
 	InputSlurp    bool              `short:"s" long:"slurp" description:"read all inputs into an array"`
+	InputLazy     bool              `long:"lazy-input" description:"decode JSON input on demand"`
 	FromFile      bool              `short:"f" long:"from-file" description:"load query from file"`
 	ModulePaths   []string          `short:"L" long:"library-path" args:"dir" description:"directory to search modules from"`
+	Lockfile      string            `long:"lockfile" args:"file" description:"verify modules with the lockfile"`
+	UpdateLock    bool              `long:"update-lockfile" description:"update the lockfile with loaded modules"`
 	Arg           map[string]string `long:"arg" args:"name value" description:"set a string value to a variable"`
 	ArgJSON       map[string]string `long:"argjson" args:"name value" description:"set a JSON value to a variable"`
 	SlurpFile     map[string]string `long:"slurpfile" args:"name file" description:"set the JSON contents of a file to a variable"`
 	RawFile       map[string]string `long:"rawfile" args:"name file" description:"set the contents of a file to a variable"`
 	Args          []any             `long:"args" positional:"" description:"consume remaining arguments as positional string values"`
 	JSONArgs      []any             `long:"jsonargs" positional:"" description:"consume remaining arguments as positional JSON values"`
+	Parallel      *int              `long:"parallel" args:"number" description:"number of goroutines to process inputs"`
+	Seed          *int              `long:"seed" args:"number" description:"seed for random number functions"`
 	ExitStatus    bool              `short:"e" long:"exit-status" description:"exit 1 when the last value is false or null"`
 	Version       bool              `short:"v" long:"version" description:"display version information"`
 	Help          bool              `short:"h" long:"help" description:"display this help information"`
@@ -149,11 +163,25 @@ Usage:
 			return fmt.Errorf("negative indentation count: %d", *i)
 		}
 	}
+	cli.parallel = 1
+	if n := opts.Parallel; n != nil {
+		if *n < 1 {
+			return fmt.Errorf("parallel count should be positive: %d", *n)
+		}
+		cli.parallel = *n
+		if cli.parallel > 1 {
+			if opts.Seed != nil {
+				// The random numbers are drawn in the order of scheduling.
+				return errors.New("cannot use --seed with --parallel")
+			}
+			cli.errStream = &lockedWriter{w: cli.errStream}
+		}
+	}
 	if opts.OutputYAML && opts.OutputTab {
 		return errors.New("cannot use tabs for YAML output")
 	}
-	cli.inputRaw, cli.inputStream, cli.inputYAML, cli.inputSlurp =
-		opts.InputRaw, opts.InputStream, opts.InputYAML, opts.InputSlurp
+	cli.inputRaw, cli.inputStream, cli.inputYAML, cli.inputSlurp, cli.inputLazy =
+		opts.InputRaw, opts.InputStream, opts.InputYAML, opts.InputSlurp, opts.InputLazy
 	for k, v := range opts.Arg {
 		cli.argnames = append(cli.argnames, "$"+k)
 		cli.argvalues = append(cli.argvalues, v)
@@ -236,47 +264,104 @@ Usage:
 	if len(modulePaths) == 0 && addDefaultModulePaths {
 		modulePaths = []string{"~/.jq", "$ORIGIN/../lib/gojq", "$ORIGIN/../lib"}
 	}
+	moduleLoader := gojq.NewModuleLoader(modulePaths, dataFormats...)
+	var lock *gojq.ModuleLock
+	if opts.Lockfile != "" || opts.UpdateLock {
+		if opts.Lockfile == "" {
+			opts.Lockfile = "gojq.lock"
+		}
+		if lock, err = readLockfile(opts.Lockfile, opts.UpdateLock); err != nil {
+			return err
+		}
+		moduleLoader = gojq.NewModuleLoaderWithLock(modulePaths, lock, opts.UpdateLock, dataFormats...)
+	}
 	iter := cli.createInputIter(args)
+	if cli.parallel > 1 {
+		iter = &parallelInputIter{inputIter: iter}
+	}
 	defer iter.Close()
+	if opts.InputNull && len(args) == 0 {
+		// input_filename returns null for the standard input like jq
+		iter = stdinInputIter{iter}
+	}
+	var randSource rand.Source
+	if opts.Seed != nil {
+		randSource = rand.NewPCG(uint64(*opts.Seed), 0)
+	}
 	code, err := gojq.Compile(query,
-		gojq.WithModuleLoader(gojq.NewModuleLoader(modulePaths)),
+		gojq.WithModuleLoader(moduleLoader),
 		gojq.WithEnvironLoader(os.Environ),
 		gojq.WithVariables(cli.argnames),
 		gojq.WithFunction("debug", 0, 0, cli.funcDebug),
 		gojq.WithFunction("stderr", 0, 0, cli.funcStderr),
-		gojq.WithFunction("input_filename", 0, 0,
-			func(iter inputIter) func(any, []any) any {
-				return func(any, []any) any {
-					if fname := iter.Name(); fname != "" && (len(args) > 0 || !opts.InputNull) {
-						return fname
-					}
-					return nil
-				}
-			}(iter),
-		),
 		gojq.WithInputIter(iter),
+		gojq.WithRandSource(randSource),
 	)
 	if err != nil {
-		if err, ok := err.(interface {
+		var chain string
+		if e, ok := err.(interface{ ImportChain() string }); ok {
+			chain = e.ImportChain()
+		}
+		if e := (interface {
 			QueryParseError() (string, string, error)
-		}); ok {
-			name, query, err := err.QueryParseError()
-			return &queryParseError{name, query, err}
+		})(nil); errors.As(err, &e) {
+			name, query, err := e.QueryParseError()
+			return withImportChain(&queryParseError{name, query, err}, chain)
 		}
-		if err, ok := err.(interface {
+		if e := (interface {
 			JSONParseError() (string, string, error)
-		}); ok {
-			fname, contents, err := err.JSONParseError()
-			return &compileError{&jsonParseError{fname, contents, 0, err}}
+		})(nil); errors.As(err, &e) {
+			fname, contents, err := e.JSONParseError()
+			return withImportChain(&compileError{&jsonParseError{fname, contents, 0, err}}, chain)
+		}
+		if e := (interface {
+			DataParseError() (string, string, string, error)
+		})(nil); errors.As(err, &e) {
+			if format, fname, contents, err := e.DataParseError(); format == "yaml" {
+				return withImportChain(&compileError{&yamlParseError{fname, contents, err}}, chain)
+			}
 		}
 		return &compileError{err}
 	}
+	if opts.UpdateLock {
+		if err := writeLockfile(opts.Lockfile, lock); err != nil {
+			return err
+		}
+	}
 	if opts.InputNull {
-		iter = newNullInputIter()
+		return cli.process(newNullInputIter(), code)
+	}
+	if cli.streamable(code) {
+		iter = cli.createReaderIter(args, code)
+		defer iter.Close()
+		return cli.processResults(iter)
 	}
 	return cli.process(iter, code)
 }
 
+func readLockfile(name string, update bool) (*gojq.ModuleLock, error) {
+	lock := gojq.ModuleLock{Dir: filepath.Dir(name)}
+	cnt, err := os.ReadFile(name)
+	if err != nil {
+		if update && errors.Is(err, fs.ErrNotExist) {
+			return &lock, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(cnt, &lock); err != nil {
+		return nil, &jsonParseError{name, string(cnt), 0, err}
+	}
+	return &lock, nil
+}
+
+func writeLockfile(name string, lock *gojq.ModuleLock) error {
+	cnt, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(cnt, '\n'), 0o644)
+}
+
 func slurpFile(name string) (any, error) {
 	iter := newSlurpInputIter(
 		newFilesInputIter(newJSONInputIter, []string{name}, nil),
@@ -302,6 +387,8 @@ func (cli *cli) createInputIter(args []string) (iter inputIter) {
 		newIter = newStreamInputIter
 	case cli.inputYAML:
 		newIter = newYAMLInputIter
+	case cli.inputLazy && !cli.inputSlurp:
+		newIter = newLazyJSONInputIter
 	default:
 		newIter = newJSONInputIter
 	}
@@ -320,7 +407,25 @@ func (cli *cli) createInputIter(args []string) (iter inputIter) {
 	return newFilesInputIter(newIter, args, cli.inStream)
 }
 
+// streamable reports whether the code can be evaluated against the token
+// stream of the JSON inputs, without decoding the whole values.
+func (cli *cli) streamable(code *gojq.Code) bool {
+	return !cli.inputRaw && !cli.inputStream && !cli.inputYAML && !cli.inputSlurp &&
+		!cli.inputLazy && cli.parallel == 1 && code.Streamable()
+}
+
+func (cli *cli) createReaderIter(args []string, code *gojq.Code) inputIter {
+	newIter := newReaderInputIter(code, cli.argvalues)
+	if len(args) == 0 {
+		return newIter(cli.inStream, "<stdin>")
+	}
+	return newFilesInputIter(newIter, args, cli.inStream)
+}
+
 func (cli *cli) process(iter inputIter, code *gojq.Code) error {
+	if cli.parallel > 1 {
+		return cli.processParallel(iter, code)
+	}
 	var err error
 	for {
 		v, ok := iter.Next()
@@ -333,21 +438,10 @@ func (cli *cli) process(iter inputIter, code *gojq.Code) error {
 			continue
 		}
 		if e := cli.printValues(code.Run(v, cli.argvalues...)); e != nil {
-			if e, ok := e.(*gojq.HaltError); ok {
-				if v := e.Value(); v != nil {
-					if str, ok := v.(string); ok {
-						cli.errStream.Write([]byte(str))
-					} else {
-						bs, _ := gojq.Marshal(v)
-						cli.errStream.Write(bs)
-						cli.errStream.Write([]byte{'\n'})
-					}
-				}
-				err = e
+			err = e
+			if cli.printError(e) {
 				break
 			}
-			fmt.Fprintf(cli.errStream, "%s: %s\n", name, e)
-			err = e
 		}
 	}
 	if err != nil {
@@ -356,6 +450,46 @@ func (cli *cli) process(iter inputIter, code *gojq.Code) error {
 	return nil
 }
 
+func (cli *cli) processParallel(iter inputIter, code *gojq.Code) error {
+	return cli.processResults(
+		code.RunParallel(context.Background(), iter, cli.parallel, cli.argvalues...),
+	)
+}
+
+func (cli *cli) processResults(results gojq.Iter) error {
+	var err error
+	for {
+		e := cli.printValues(results)
+		if e == nil {
+			break
+		}
+		err = e
+		if cli.printError(e) {
+			break
+		}
+	}
+	if err != nil {
+		return &emptyError{err}
+	}
+	return nil
+}
+
+func (cli *cli) printError(err error) (halt bool) {
+	if err, ok := err.(*gojq.HaltError); ok {
+		if v := err.Value(); v != nil {
+			if str, ok := v.(string); ok {
+				cli.errStream.Write([]byte(str))
+			} else {
+				bs, _ := gojq.Marshal(v)
+				cli.errStream.Write(append(bs, '\n'))
+			}
+		}
+		return true
+	}
+	fmt.Fprintf(cli.errStream, "%s: %s\n", name, err)
+	return false
+}
+
 func (cli *cli) printValues(iter gojq.Iter) error {
 	m := cli.createMarshaler()
 	for {
@@ -375,7 +509,7 @@ func (cli *cli) printValues(iter gojq.Iter) error {
 			return err
 		}
 		if cli.exitCodeError != nil {
-			if v == nil || v == false {
+			if v := decodeRawJSON(v); v == nil || v == false {
 				cli.exitCodeError = &exitCodeError{exitCodeFalsyErr}
 			} else {
 				cli.exitCodeError = &exitCodeError{exitCodeOK}
@@ -412,11 +546,13 @@ func (cli *cli) createMarshaler() marshaler {
 }
 
 func (cli *cli) funcDebug(v any, _ []any) any {
+	var buf bytes.Buffer
 	if err := newEncoder(false, -1).
-		marshal([]any{"DEBUG:", v}, cli.errStream); err != nil {
+		marshal([]any{"DEBUG:", v}, &buf); err != nil {
 		return err
 	}
-	if _, err := cli.errStream.Write([]byte{'\n'}); err != nil {
+	buf.WriteByte('\n')
+	if _, err := cli.errStream.Write(buf.Bytes()); err != nil {
 		return err
 	}
 	return v
@@ -429,3 +565,14 @@ func (cli *cli) funcStderr(v any, _ []any) any {
 	}
 	return v
 }
+
+type lockedWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
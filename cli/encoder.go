@@ -11,6 +11,8 @@ import (
 	"sort"
 	"strconv"
 	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
 )
 
 type encoder struct {
@@ -56,6 +58,16 @@ func (e *encoder) encode(v any) error {
 		e.write(v.Append(e.buf[:0], 10), numberColor)
 	case json.Number:
 		e.write([]byte(v.String()), numberColor)
+	case json.RawMessage:
+		if e.indent >= 0 || !noColor {
+			return e.encode(decodeRawJSON(v))
+		}
+		// emit the untouched value of --lazy-input option without decoding
+		b, err := gojq.Marshal(v)
+		if err != nil {
+			return err
+		}
+		e.w.Write(b)
 	case string:
 		e.encodeString(v, stringColor)
 	case []any:
@@ -70,6 +70,26 @@ func (*compileError) ExitCode() int {
 	return exitCodeCompileErr
 }
 
+type importChainError struct {
+	chain string
+	err   error
+}
+
+func withImportChain(err error, chain string) error {
+	if chain == "" {
+		return err
+	}
+	return &importChainError{chain, err}
+}
+
+func (err *importChainError) Error() string {
+	return err.err.Error() + "\n    import chain: " + err.chain
+}
+
+func (*importChainError) ExitCode() int {
+	return exitCodeCompileErr
+}
+
 type queryParseError struct {
 	fname, contents string
 	err             error
@@ -102,10 +122,12 @@ type jsonParseError struct {
 
 func (err *jsonParseError) Error() string {
 	var offset int
-	if err.err == io.ErrUnexpectedEOF {
+	if errors.Is(err.err, io.ErrUnexpectedEOF) {
 		offset = len(err.contents) + 1
 	} else if e, ok := err.err.(*json.SyntaxError); ok {
 		offset = int(e.Offset)
+	} else if e, ok := err.err.(*gojq.DecodeError); ok {
+		offset = int(e.Offset)
 	}
 	linestr, line, column := getLineByOffset(err.contents, offset)
 	if line += err.line; line > 1 {
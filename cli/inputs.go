@@ -3,10 +3,13 @@ package cli
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/itchyny/go-yaml"
 
@@ -60,32 +63,50 @@ func (ir *inputReader) getContents(offset *int64, line *int) string {
 }
 
 type inputIter interface {
-	gojq.Iter
+	gojq.InputMetadataIter
 	io.Closer
-	Name() string
 }
 
 type jsonInputIter struct {
-	next   func() (any, error)
-	ir     *inputReader
-	fname  string
-	offset int64
-	line   int
-	err    error
+	next        func() (any, error)
+	inputOffset func() int64
+	ir          *inputReader
+	fname       string
+	offset      int64
+	line        int
+	start       int64 // the offset after the previous value
+	valueOffset int64 // the offset of the last value, or -1 if not counted
+	valueLine   int
+	lineOffset  int64 // the last counted offset
+	lineCount   int   // the number of newlines before lineOffset
+	emitted     bool
+	err         error
 }
 
 func newJSONInputIter(r io.Reader, fname string) inputIter {
 	ir := newInputReader(r)
-	dec := json.NewDecoder(ir)
-	dec.UseNumber()
-	next := func() (v any, err error) { err = dec.Decode(&v); return }
-	return &jsonInputIter{next: next, ir: ir, fname: fname}
+	dec := gojq.NewDecoder(ir)
+	dec.AllowNonFinite()
+	return &jsonInputIter{next: dec.Decode, inputOffset: dec.InputOffset, ir: ir, fname: fname}
+}
+
+// newLazyJSONInputIter creates an iterator of the JSON values, which are decoded
+// on demand by the query. The values with the non-finite numbers are decoded in
+// advance.
+func newLazyJSONInputIter(r io.Reader, fname string) inputIter {
+	ir := newInputReader(r)
+	dec := gojq.NewDecoder(ir)
+	dec.AllowNonFinite()
+	return &jsonInputIter{next: dec.DecodeLazy, inputOffset: dec.InputOffset, ir: ir, fname: fname}
 }
 
 func (i *jsonInputIter) Next() (any, bool) {
 	if i.err != nil {
 		return nil, false
 	}
+	if i.inputOffset != nil {
+		i.start, i.valueOffset = i.inputOffset(), -1
+	}
 	v, err := i.next()
 	if err != nil {
 		if err == io.EOF {
@@ -97,7 +118,10 @@ func (i *jsonInputIter) Next() (any, bool) {
 		if e, ok := err.(*json.SyntaxError); ok {
 			e.Offset -= i.offset
 			offset, line = &e.Offset, &i.line
-		} else if err == io.ErrUnexpectedEOF && i.ir.rs != nil {
+		} else if e, ok := err.(*gojq.DecodeError); ok && !errors.Is(e, io.ErrUnexpectedEOF) {
+			e.Offset -= i.offset
+			offset, line = &e.Offset, &i.line
+		} else if errors.Is(err, io.ErrUnexpectedEOF) && i.ir.rs != nil {
 			if pos, err := i.ir.rs.Seek(0, io.SeekEnd); err == nil {
 				offset, line = &pos, &i.line
 			}
@@ -105,12 +129,21 @@ func (i *jsonInputIter) Next() (any, bool) {
 		i.err = &jsonParseError{i.fname, i.ir.getContents(offset, line), i.line, err}
 		return i.err, true
 	}
+	i.resetBuffer()
+	i.emitted = true
+	return v, true
+}
+
+func (i *jsonInputIter) resetBuffer() {
 	if buf := i.ir.buf; buf != nil && buf.Len() >= 16*1024 {
-		i.offset += int64(buf.Len())
-		i.line += bytes.Count(buf.Bytes(), []byte{'\n'})
-		buf.Reset()
+		n := buf.Len()
+		if i.inputOffset != nil {
+			// keep the bytes after the previous value for the input metadata
+			n = int(min(int64(n), i.start-i.offset))
+		}
+		i.offset += int64(n)
+		i.line += bytes.Count(buf.Next(n), []byte{'\n'})
 	}
-	return v, true
 }
 
 func (i *jsonInputIter) Close() error {
@@ -118,17 +151,156 @@ func (i *jsonInputIter) Close() error {
 	return nil
 }
 
-func (i *jsonInputIter) Name() string {
-	return i.fname
+// InputMetadata returns the metadata of the last value. The offset and the line
+// number of the value are computed on demand by reading the input again from
+// the last counted position.
+func (i *jsonInputIter) InputMetadata() gojq.InputMetadata {
+	if !i.emitted {
+		return gojq.InputMetadata{Offset: -1}
+	}
+	if i.inputOffset == nil {
+		return gojq.InputMetadata{Filename: i.fname, Offset: -1}
+	}
+	if i.valueOffset < 0 {
+		i.countLines()
+	}
+	return gojq.InputMetadata{Filename: i.fname, Offset: i.valueOffset, Line: i.valueLine + 1}
+}
+
+// countLines counts the newlines before the last value, which starts at the
+// first non-space byte after the previous value.
+func (i *jsonInputIter) countLines() {
+	offset, line := i.lineOffset, i.lineCount
+	var r io.Reader
+	if buf := i.ir.buf; buf != nil {
+		if offset < i.offset {
+			offset, line = i.offset, i.line
+		}
+		r = bytes.NewReader(buf.Bytes()[offset-i.offset:])
+	} else {
+		current, err := i.ir.rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return
+		}
+		defer i.ir.rs.Seek(current, io.SeekStart)
+		if _, err := i.ir.rs.Seek(offset, io.SeekStart); err != nil {
+			return
+		}
+		r = i.ir.rs
+	}
+	br := bufio.NewReader(r)
+	for ; ; offset++ {
+		c, err := br.ReadByte()
+		if err != nil {
+			break
+		}
+		if c == '\n' {
+			line++
+		} else if offset >= i.start && c != ' ' && c != '\t' && c != '\r' &&
+			(offset >= 3 || c < 0xBB) { // skip the byte order mark
+			break
+		}
+	}
+	i.lineOffset, i.lineCount = offset, line
+	i.valueOffset, i.valueLine = offset, line
 }
 
 func newStreamInputIter(r io.Reader, fname string) inputIter {
 	ir := newInputReader(r)
-	dec := json.NewDecoder(ir)
-	dec.UseNumber()
+	dec := gojq.NewDecoder(ir)
+	dec.AllowNonFinite()
 	return &jsonInputIter{next: newJSONStream(dec).next, ir: ir, fname: fname}
 }
 
+// newReaderInputIter creates an iterator of the results of the code, which is
+// evaluated against the token stream of the input (refer to gojq.Code.RunDecoder).
+// Since the results are emitted without decoding the whole JSON value, the
+// buffer for the error message is reset on reading the input.
+func newReaderInputIter(code *gojq.Code, values []any) func(io.Reader, string) inputIter {
+	return func(r io.Reader, fname string) inputIter {
+		i := &jsonInputIter{ir: newInputReader(r), fname: fname}
+		dec := gojq.NewDecoder(readerFunc(func(p []byte) (int, error) {
+			i.resetBuffer()
+			return i.ir.Read(p)
+		}))
+		dec.AllowNonFinite()
+		iter := code.RunDecoder(context.Background(), dec, values...)
+		i.next = func() (any, error) {
+			v, ok := iter.Next()
+			if !ok {
+				return nil, io.EOF
+			}
+			if err, ok := v.(*gojq.DecodeError); ok {
+				return nil, err
+			} else if v == io.ErrUnexpectedEOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return v, nil
+		}
+		return i
+	}
+}
+
+// stdinInputIter hides the file name of the standard input, which is read by
+// input and inputs functions with --null-input option.
+type stdinInputIter struct {
+	inputIter
+}
+
+func (i stdinInputIter) InputMetadata() gojq.InputMetadata {
+	m := i.inputIter.InputMetadata()
+	m.Filename = ""
+	return m
+}
+
+// parallelInputIter allows closing the iterator while the goroutine of the
+// parallel iterator is reading the next value, which can be blocked until the
+// next input is available. The value being read is closed after the read.
+type parallelInputIter struct {
+	inputIter
+	mu      sync.Mutex
+	reading bool
+	closed  bool
+}
+
+func (i *parallelInputIter) Next() (any, bool) {
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+		return nil, false
+	}
+	i.reading = true
+	i.mu.Unlock()
+	v, ok := i.inputIter.Next()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.reading = false
+	if i.closed {
+		i.inputIter.Close()
+		return nil, false
+	}
+	return v, ok
+}
+
+func (i *parallelInputIter) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.closed {
+		return nil
+	}
+	i.closed = true
+	if i.reading {
+		return nil
+	}
+	return i.inputIter.Close()
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
 type nullInputIter struct {
 	err error
 }
@@ -150,8 +322,8 @@ func (i *nullInputIter) Close() error {
 	return nil
 }
 
-func (*nullInputIter) Name() string {
-	return ""
+func (*nullInputIter) InputMetadata() gojq.InputMetadata {
+	return gojq.InputMetadata{Offset: -1}
 }
 
 type filesInputIter struct {
@@ -220,17 +392,20 @@ func (i *filesInputIter) Close() error {
 	return nil
 }
 
-func (i *filesInputIter) Name() string {
+func (i *filesInputIter) InputMetadata() gojq.InputMetadata {
 	if i.iter != nil {
-		return i.iter.Name()
+		return i.iter.InputMetadata()
 	}
-	return ""
+	return gojq.InputMetadata{Offset: -1}
 }
 
 type rawInputIter struct {
-	r     *bufio.Reader
-	fname string
-	err   error
+	r      *bufio.Reader
+	fname  string
+	offset int64 // the offset of the last line
+	next   int64 // the offset of the next line
+	line   int
+	err    error
 }
 
 func newRawInputIter(r io.Reader, fname string) inputIter {
@@ -251,6 +426,7 @@ func (i *rawInputIter) Next() (any, bool) {
 			return nil, false
 		}
 	}
+	i.offset, i.next, i.line = i.next, i.next+int64(len(line)), i.line+1
 	return strings.TrimSuffix(line, "\n"), true
 }
 
@@ -259,15 +435,19 @@ func (i *rawInputIter) Close() error {
 	return nil
 }
 
-func (i *rawInputIter) Name() string {
-	return i.fname
+func (i *rawInputIter) InputMetadata() gojq.InputMetadata {
+	if i.line == 0 {
+		return gojq.InputMetadata{Offset: -1}
+	}
+	return gojq.InputMetadata{Filename: i.fname, Offset: i.offset, Line: i.line}
 }
 
 type yamlInputIter struct {
-	dec   *yaml.Decoder
-	ir    *inputReader
-	fname string
-	err   error
+	dec     *yaml.Decoder
+	ir      *inputReader
+	fname   string
+	emitted bool
+	err     error
 }
 
 func newYAMLInputIter(r io.Reader, fname string) inputIter {
@@ -289,6 +469,7 @@ func (i *yamlInputIter) Next() (any, bool) {
 		i.err = &yamlParseError{i.fname, i.ir.getContents(nil, nil), err}
 		return i.err, true
 	}
+	i.emitted = true
 	return v, true
 }
 
@@ -297,8 +478,11 @@ func (i *yamlInputIter) Close() error {
 	return nil
 }
 
-func (i *yamlInputIter) Name() string {
-	return i.fname
+func (i *yamlInputIter) InputMetadata() gojq.InputMetadata {
+	if !i.emitted {
+		return gojq.InputMetadata{Offset: -1}
+	}
+	return gojq.InputMetadata{Filename: i.fname, Offset: -1}
 }
 
 type slurpInputIter struct {
@@ -339,14 +523,15 @@ func (i *slurpInputIter) Close() error {
 	return nil
 }
 
-func (i *slurpInputIter) Name() string {
-	return i.iter.Name()
+func (i *slurpInputIter) InputMetadata() gojq.InputMetadata {
+	return i.iter.InputMetadata()
 }
 
 type readAllIter struct {
-	r     io.Reader
-	fname string
-	err   error
+	r       io.Reader
+	fname   string
+	emitted bool
+	err     error
 }
 
 func newReadAllIter(r io.Reader, fname string) inputIter {
@@ -362,6 +547,7 @@ func (i *readAllIter) Next() (any, bool) {
 	if err != nil {
 		return err, true
 	}
+	i.emitted = true
 	return string(cnt), true
 }
 
@@ -370,8 +556,11 @@ func (i *readAllIter) Close() error {
 	return nil
 }
 
-func (i *readAllIter) Name() string {
-	return i.fname
+func (i *readAllIter) InputMetadata() gojq.InputMetadata {
+	if !i.emitted {
+		return gojq.InputMetadata{Offset: -1}
+	}
+	return gojq.InputMetadata{Filename: i.fname, Offset: 0, Line: 1}
 }
 
 type slurpRawInputIter struct {
@@ -412,6 +601,6 @@ func (i *slurpRawInputIter) Close() error {
 	return nil
 }
 
-func (i *slurpRawInputIter) Name() string {
-	return i.iter.Name()
+func (i *slurpRawInputIter) InputMetadata() gojq.InputMetadata {
+	return i.iter.InputMetadata()
 }
@@ -8,6 +8,8 @@ import (
 	"slices"
 	"strings"
 	"testing"
+
+	"github.com/itchyny/gojq"
 )
 
 func TestJSONInputIter(t *testing.T) {
@@ -25,7 +27,7 @@ func TestJSONInputIter(t *testing.T) {
 		{
 			name:     "scalars",
 			input:    "null true false 1 2.3 \"hello\"",
-			expected: []any{nil, true, false, json.Number("1"), json.Number("2.3"), "hello"},
+			expected: []any{nil, true, false, 1, json.Number("2.3"), "hello"},
 		},
 		{
 			name:  "arrays",
@@ -34,7 +36,7 @@ func TestJSONInputIter(t *testing.T) {
 				[]any{},
 				[]any{[]any{}},
 				[]any{json.Number("1.2")},
-				[]any{json.Number("3"), []any{json.Number("4")}},
+				[]any{3, []any{4}},
 			},
 		},
 		{
@@ -42,14 +44,14 @@ func TestJSONInputIter(t *testing.T) {
 			input: `{}{"a":1,"b":2}{"a":{"b":3,"c":4}}`,
 			expected: []any{
 				map[string]any{},
-				map[string]any{"a": json.Number("1"), "b": json.Number("2")},
-				map[string]any{"a": map[string]any{"b": json.Number("3"), "c": json.Number("4")}},
+				map[string]any{"a": 1, "b": 2},
+				map[string]any{"a": map[string]any{"b": 3, "c": 4}},
 			},
 		},
 		{
 			name:     "unexpected EOF error",
 			input:    "0[1",
-			expected: []any{json.Number("0")},
+			expected: []any{0},
 			expectedErr: `invalid json: test.json
     0[1
        ^  unexpected EOF`,
@@ -57,7 +59,7 @@ func TestJSONInputIter(t *testing.T) {
 		{
 			name:     "array value error",
 			input:    `0["a",]`,
-			expected: []any{json.Number("0")},
+			expected: []any{0},
 			expectedErr: `invalid json: test.json
     0["a",]
           ^  invalid character ']' looking for beginning of value`,
@@ -65,7 +67,7 @@ func TestJSONInputIter(t *testing.T) {
 		{
 			name:     "object key error",
 			input:    "0\n{\n  0",
-			expected: []any{json.Number("0")},
+			expected: []any{0},
 			expectedErr: `invalid json: test.json:3
     3 |   0
           ^  invalid character '0' looking for beginning of object key string`,
@@ -73,7 +75,7 @@ func TestJSONInputIter(t *testing.T) {
 		{
 			name:     "object value error",
 			input:    "0\n{\n  \"a\":\n}",
-			expected: []any{json.Number("0")},
+			expected: []any{0},
 			expectedErr: `invalid json: test.json:4
     4 | }
         ^  invalid character '}' looking for beginning of value`,
@@ -81,7 +83,7 @@ func TestJSONInputIter(t *testing.T) {
 		{
 			name:     "large input with unexpected EOF error",
 			input:    "0[0," + strings.Repeat("\n", 40*1024) + "1\n",
-			expected: []any{json.Number("0")},
+			expected: []any{0},
 			expectedErr: fmt.Sprintf(`invalid json: test.json:%[1]d
     %[1]d | 1
              ^  unexpected EOF`, 40*1024+1),
@@ -89,7 +91,7 @@ func TestJSONInputIter(t *testing.T) {
 		{
 			name:     "large input with array value error",
 			input:    "0[0," + strings.Repeat("\n", 40*1024) + "]",
-			expected: []any{json.Number("0")},
+			expected: []any{0},
 			expectedErr: fmt.Sprintf(`invalid json: test.json:%[1]d
     %[1]d | ]
             ^  invalid character ']' looking for beginning of value`, 40*1024+1),
@@ -97,7 +99,7 @@ func TestJSONInputIter(t *testing.T) {
 		{
 			name:     "large input with object key error",
 			input:    `0{"a"` + strings.Repeat("\n", 40*1024) + ":0,1}",
-			expected: []any{json.Number("0")},
+			expected: []any{0},
 			expectedErr: fmt.Sprintf(`invalid json: test.json:%[1]d
     %[1]d | :0,1}
                ^  invalid character '1' looking for beginning of object key string`, 40*1024+1),
@@ -105,7 +107,7 @@ func TestJSONInputIter(t *testing.T) {
 		{
 			name:     "many input values with value error",
 			input:    strings.Repeat("0\n", 40*1024) + ":\n",
-			expected: slices.Repeat([]any{json.Number("0")}, 40*1024),
+			expected: slices.Repeat([]any{0}, 40*1024),
 			expectedErr: fmt.Sprintf(`invalid json: test.json:%[1]d
     %[1]d | :
             ^  invalid character ':' looking for beginning of value`, 40*1024+1),
@@ -141,6 +143,36 @@ func TestJSONInputIter(t *testing.T) {
 	}
 }
 
+func TestJSONInputIterMetadata(t *testing.T) {
+	input := "\xEF\xBB\xBF0\n" + strings.Repeat(`{"a": "`+strings.Repeat("x", 100)+"\"}\n\n", 1000) + " [\n1]"
+	for _, r := range []io.Reader{strings.NewReader(input), newStringReader(input)} {
+		t.Run(fmt.Sprintf("%T", r), func(t *testing.T) {
+			iter := newJSONInputIter(r, "test.json")
+			if got, expected := iter.InputMetadata(), (gojq.InputMetadata{Offset: -1}); got != expected {
+				t.Errorf("InputMetadata(): got: %#v, expected: %#v", got, expected)
+			}
+			for i := 0; ; i++ {
+				if _, ok := iter.Next(); !ok {
+					break
+				}
+				if i%100 != 0 && i != 1001 {
+					continue
+				}
+				expected := gojq.InputMetadata{Filename: "test.json", Offset: 3, Line: 1}
+				if i > 0 {
+					expected.Offset, expected.Line = 5+int64(i-1)*111, 2+(i-1)*2
+				}
+				if i == 1001 {
+					expected.Offset++
+				}
+				if got := iter.InputMetadata(); got != expected {
+					t.Errorf("InputMetadata() of value %d: got: %#v, expected: %#v", i, got, expected)
+				}
+			}
+		})
+	}
+}
+
 func TestYAMLInputIter(t *testing.T) {
 	for _, tc := range []struct {
 		name        string
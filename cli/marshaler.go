@@ -1,6 +1,8 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
@@ -18,6 +20,9 @@ type rawMarshaler struct {
 }
 
 func (m *rawMarshaler) marshal(v any, w io.Writer) error {
+	if raw, ok := v.(json.RawMessage); ok && len(raw) > 0 && raw[0] == '"' {
+		v = decodeRawJSON(raw)
+	}
 	if s, ok := v.(string); ok {
 		if m.checkNul && strings.ContainsRune(s, '\x00') {
 			return fmt.Errorf("cannot output a string containing NUL character: %q", s)
@@ -43,8 +48,22 @@ func (m *yamlMarshaler) marshal(v any, w io.Writer) error {
 	} else {
 		enc.SetIndent(2)
 	}
-	if err := enc.Encode(v); err != nil {
+	if err := enc.Encode(decodeRawJSON(v)); err != nil {
 		return err
 	}
 	return enc.Close()
 }
+
+// decodeRawJSON decodes v when v is a [json.RawMessage] emitted by the query
+// against the input of --lazy-input option.
+func decodeRawJSON(v any) any {
+	raw, ok := v.(json.RawMessage)
+	if !ok {
+		return v
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var w any
+	_ = dec.Decode(&w)
+	return w
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+
+	"github.com/itchyny/go-yaml"
+
+	"github.com/itchyny/gojq"
+)
+
+// The data formats which can be imported as module data, in addition to JSON.
+var dataFormats = []gojq.ModuleLoaderOption{
+	gojq.WithDataFormat("yaml", []string{".yaml", ".yml"}, decodeYAMLData),
+	gojq.WithDataFormat("csv", []string{".csv"}, decodeCSVData),
+}
+
+func decodeYAMLData(cnt []byte) ([]any, error) {
+	var vals []any
+	dec := yaml.NewDecoder(bytes.NewReader(cnt))
+	for {
+		var val any
+		if err := dec.Decode(&val); err != nil {
+			if errors.Is(err, io.EOF) {
+				return vals, nil
+			}
+			return nil, err
+		}
+		vals = append(vals, val)
+	}
+}
+
+func decodeCSVData(cnt []byte) ([]any, error) {
+	records, err := csv.NewReader(bytes.NewReader(cnt)).ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	vals := make([]any, 0, len(records)-1)
+	header := records[0]
+	for _, record := range records[1:] {
+		val := make(map[string]any, len(header))
+		for i, key := range header {
+			val[key] = record[i]
+		}
+		vals = append(vals, val)
+	}
+	return vals, nil
+}
@@ -3,15 +3,17 @@ package cli
 import (
 	"encoding/json"
 	"io"
+
+	"github.com/itchyny/gojq"
 )
 
 type jsonStream struct {
-	dec    *json.Decoder
+	dec    *gojq.Decoder
 	path   []any
 	states []int
 }
 
-func newJSONStream(dec *json.Decoder) *jsonStream {
+func newJSONStream(dec *gojq.Decoder) *jsonStream {
 	return &jsonStream{dec: dec, states: []int{jsonStateTopValue}, path: []any{}}
 }
 
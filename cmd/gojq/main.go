@@ -3,6 +3,7 @@ package main
 
 import (
 	"os"
+	_ "time/tzdata" // embed the time zone database for the date and time functions
 
 	"github.com/itchyny/gojq/cli"
 )
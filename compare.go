@@ -11,6 +11,7 @@ import (
 // The result will be 0 if l == r, -1 if l < r, and +1 if l > r.
 // This comparison is used by built-in operators and functions.
 func Compare(l, r any) int {
+	l, r = decodeRawMessage(l), decodeRawMessage(r)
 	return binopTypeSwitch(l, r,
 		cmp.Compare,
 		func(l, r float64) int {
@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
+	"math/rand/v2"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,12 +20,21 @@ type compiler struct {
 	variables     []string
 	customFuncs   map[string]function
 	inputIter     Iter
+	usesInput     bool
+	imports       []importinfo
+	privateFuncs  map[string]string
 	codes         []*code
 	codeinfos     []codeinfo
 	builtinScope  *scopeinfo
 	scopes        []*scopeinfo
 	scopecnt      int
+	regexpEngine  RegexpEngine
 	regexpCache   sync.Map
+	randSource    rand.Source
+	rand          *rand.Rand
+	randMutex     sync.Mutex
+	prelude       bool
+	precompiled   *compiler
 }
 
 // Code is a compiled jq query.
@@ -29,12 +42,21 @@ type Code struct {
 	variables []string
 	codes     []*code
 	codeinfos []codeinfo
+	usesInput bool
+	path      []any
 }
 
 // Run runs the code with the variable values (which should be in the
 // same order as the given variables using [WithVariables]) and returns
 // a result iterator.
 //
+// When the input value or a variable value is a [json.RawMessage], the value
+// is decoded on demand; indexing and iterating the value do not decode the
+// entire value, and the values which are not passed to any function are
+// emitted as [json.RawMessage] of the original bytes. This is useful to query
+// a few fields of large JSON values. The value is validated before the
+// evaluation, unless the value is read by [*Decoder.DecodeLazy].
+//
 // It is safe to call this method in goroutines, to reuse a compiled [*Code].
 func (c *Code) Run(v any, values ...any) Iter {
 	return c.RunWithContext(context.Background(), v, values...)
@@ -76,7 +98,14 @@ func Compile(q *Query, options ...CompilerOption) (*Code, error) {
 	for _, opt := range options {
 		opt(c)
 	}
-	c.builtinScope = c.newScope()
+	if c.moduleLoader != nil {
+		if err := checkModuleLoader(c.moduleLoader); err != nil {
+			return nil, err
+		}
+	}
+	c.precompiled = compilePrelude()
+	c.builtinScope = &scopeinfo{id: c.precompiled.builtinScope.id}
+	c.scopecnt = c.precompiled.scopecnt
 	scope := c.newScope()
 	c.scopes = []*scopeinfo{scope}
 	setscope := c.lazy(func() *code {
@@ -90,9 +119,7 @@ func Compile(q *Query, options ...CompilerOption) (*Code, error) {
 		c.append(&code{op: opstore, v: c.pushVariable(name)})
 	}
 	if c.moduleLoader != nil {
-		if moduleLoader, ok := c.moduleLoader.(interface {
-			LoadInitModules() ([]*Query, error)
-		}); ok {
+		if moduleLoader, ok := c.moduleLoader.(InitModuleLoader); ok {
 			qs, err := moduleLoader.LoadInitModules()
 			if err != nil {
 				return nil, err
@@ -114,9 +141,115 @@ func Compile(q *Query, options ...CompilerOption) (*Code, error) {
 		variables: c.variables,
 		codes:     c.codes,
 		codeinfos: c.codeinfos,
+		usesInput: c.usesInput,
+		path:      streamPath(q),
 	}, nil
 }
 
+// The prelude is the compiled code of the built-in functions shared by all the
+// compiled queries. When a query calls a built-in function, the code of the
+// function is copied from the prelude, instead of compiling the definition.
+// The functions which depend on the compiler options (like test and inputs)
+// are not included, and compiled on demand as before.
+var compilePrelude = sync.OnceValue(func() *compiler {
+	c := &compiler{prelude: true}
+	c.builtinScope = c.newScope()
+	for _, name := range slices.Sorted(maps.Keys(builtinFuncDefs)) {
+		fds := builtinFuncDefs[name]
+		if len(fds) == 0 {
+			switch name {
+			case "_assign":
+				c.compileAssign()
+			case "_modify":
+				c.compileModify()
+			case "_last":
+				c.compileLast()
+			}
+			continue
+		}
+		for _, fd := range fds {
+			if c.lookupBuiltin(fd.Name, len(fd.Args)) != nil {
+				continue
+			}
+			codes, codeinfos, funcs, scopecnt :=
+				len(c.codes), len(c.codeinfos), len(c.builtinScope.funcs), c.scopecnt
+			if err := c.compileFuncDef(fd, true); err != nil {
+				if _, ok := err.(*funcNotInPreludeError); !ok {
+					panic(fmt.Sprintf("failed to compile built-in function %s/%d: %s",
+						fd.Name, len(fd.Args), err))
+				}
+				c.codes, c.codeinfos = c.codes[:codes], c.codeinfos[:codeinfos]
+				c.builtinScope.funcs, c.scopecnt = c.builtinScope.funcs[:funcs], scopecnt
+			}
+		}
+	}
+	return c
+})
+
+// Copies the code of the built-in function from the prelude, along with the
+// functions it calls. The code starts with a jump to the end of the function,
+// and the program counters in the code are relocated.
+func (c *compiler) copyBuiltin(name string, argcnt int) *funcinfo {
+	p := c.precompiled
+	f := p.lookupBuiltin(name, argcnt)
+	if f == nil {
+		return nil
+	}
+	start, end := f.pc-1, p.codes[f.pc-1].v.(int)
+	pcs := map[int]int{}
+	for _, code := range p.codes[start:end] {
+		if pc, ok := code.pc(); ok && (pc < start || end < pc) {
+			if _, ok := pcs[pc]; ok {
+				continue
+			}
+			for _, g := range p.builtinScope.funcs {
+				if g.pc == pc {
+					h := c.lookupBuiltin(g.name, g.argcnt)
+					if h == nil {
+						h = c.copyBuiltin(g.name, g.argcnt)
+					}
+					pcs[pc] = h.pc
+					break
+				}
+			}
+		}
+	}
+	offset := len(c.codes) - start
+	for _, code := range p.codes[start:end] {
+		code := *code
+		if pc, ok := code.pc(); ok {
+			if start <= pc && pc <= end {
+				code.v = pc + offset
+			} else {
+				code.v = pcs[pc]
+			}
+		}
+		c.append(&code)
+	}
+	c.copyCodeInfos(p, start, end, offset)
+	for _, g := range p.builtinScope.funcs {
+		if start < g.pc && g.pc < end {
+			c.builtinScope.funcs = append(
+				c.builtinScope.funcs,
+				&funcinfo{g.name, g.pc + offset, g.argcnt},
+			)
+		}
+	}
+	return c.lookupBuiltin(name, argcnt)
+}
+
+// Returns the program counter in the operand of the code.
+func (c *code) pc() (int, bool) {
+	switch c.op {
+	case opjump, opjumpifnot, opfork, opforktrybegin, opforkalt,
+		opcall, opcallrec, oppushpc:
+		pc, ok := c.v.(int)
+		return pc, ok
+	default:
+		return 0, false
+	}
+}
+
 func (c *compiler) compile(q *Query) error {
 	for _, i := range q.Imports {
 		if err := c.compileImport(i); err != nil {
@@ -132,7 +265,6 @@ func (c *compiler) compile(q *Query) error {
 
 func (c *compiler) compileImport(i *Import) error {
 	var path, alias string
-	var err error
 	if i.ImportPath != "" {
 		path, alias = i.ImportPath, i.ImportAlias
 	} else {
@@ -141,22 +273,23 @@ func (c *compiler) compileImport(i *Import) error {
 	if c.moduleLoader == nil {
 		return fmt.Errorf("cannot load module: %q", path)
 	}
+	meta := i.Meta.ToValue()
+	search, _ := meta["search"].(string)
+	for j, imp := range c.imports {
+		if imp.path == path && imp.search == search {
+			return &importCycleError{append(c.importChain(j), path)}
+		}
+	}
+	c.imports = append(c.imports, importinfo{path, search})
+	defer func() { c.imports = c.imports[:len(c.imports)-1] }()
 	if strings.HasPrefix(alias, "$") {
-		var vals any
-		if moduleLoader, ok := c.moduleLoader.(interface {
-			LoadJSONWithMeta(string, map[string]any) (any, error)
-		}); ok {
-			if vals, err = moduleLoader.LoadJSONWithMeta(path, i.Meta.ToValue()); err != nil {
-				return err
-			}
-		} else if moduleLoader, ok := c.moduleLoader.(interface {
-			LoadJSON(string) (any, error)
-		}); ok {
-			if vals, err = moduleLoader.LoadJSON(path); err != nil {
-				return err
-			}
-		} else {
-			return fmt.Errorf("module not found: %q", path)
+		moduleLoader := toModuleJSONLoader(c.moduleLoader)
+		if moduleLoader == nil {
+			return c.importError(&moduleNotFoundError{path})
+		}
+		vals, err := moduleLoader.LoadJSONWithMeta(path, meta)
+		if err != nil {
+			return c.importError(err)
 		}
 		c.append(&code{op: oppush, v: vals})
 		c.append(&code{op: opstore, v: c.pushVariable(alias)})
@@ -164,28 +297,110 @@ func (c *compiler) compileImport(i *Import) error {
 		c.append(&code{op: opstore, v: c.pushVariable(alias + "::" + alias[1:])})
 		return nil
 	}
-	var q *Query
-	if moduleLoader, ok := c.moduleLoader.(interface {
-		LoadModuleWithMeta(string, map[string]any) (*Query, error)
-	}); ok {
-		if q, err = moduleLoader.LoadModuleWithMeta(path, i.Meta.ToValue()); err != nil {
-			return err
-		}
-	} else if moduleLoader, ok := c.moduleLoader.(interface {
-		LoadModule(string) (*Query, error)
-	}); ok {
-		if q, err = moduleLoader.LoadModule(path); err != nil {
-			return err
-		}
+	moduleLoader := toModuleQueryLoader(c.moduleLoader)
+	if moduleLoader == nil {
+		return c.importError(&moduleNotFoundError{path})
+	}
+	q, err := moduleLoader.LoadModuleWithMeta(path, meta)
+	if err != nil {
+		return c.importError(err)
 	}
 	c.appendCodeInfo("module " + path)
+	scope := c.scopes[len(c.scopes)-1]
+	l := len(scope.funcs)
 	if err = c.compileModule(q, alias); err != nil {
-		return err
+		return c.importError(err)
+	}
+	if alias != "" {
+		exports, err := moduleExports(q)
+		if err != nil {
+			return c.importError(err)
+		}
+		// hide the functions not exported from the importing module
+		funcs := scope.funcs[:l]
+		for _, f := range scope.funcs[l:] {
+			if isModuleExport(f.name[len(alias)+2:], f.argcnt, exports) {
+				funcs = append(funcs, f)
+			} else {
+				if c.privateFuncs == nil {
+					c.privateFuncs = make(map[string]string)
+				}
+				c.privateFuncs[f.name+"/"+strconv.Itoa(f.argcnt)] = path
+			}
+		}
+		scope.funcs = funcs
 	}
 	c.appendCodeInfo("end of module " + path)
 	return nil
 }
 
+// Returns the set of exported functions specified by the module metadata
+// (module {exports: ["f/0", "g/1"]}), or nil if not specified.
+func moduleExports(q *Query) (map[string]bool, error) {
+	v, ok := q.Meta.ToValue()["exports"]
+	if !ok {
+		return nil, nil
+	}
+	vs, ok := v.([]any)
+	if !ok {
+		return nil, &moduleExportsError{v}
+	}
+	exports := make(map[string]bool, len(vs))
+	for _, v := range vs {
+		s, ok := v.(string)
+		if !ok {
+			return nil, &moduleExportsError{v}
+		}
+		exports[s] = true
+	}
+	return exports, nil
+}
+
+// Functions with names starting with an underscore are not exported unless
+// the module specifies the exported functions explicitly.
+func isModuleExport(name string, argcnt int, exports map[string]bool) bool {
+	if exports != nil {
+		return exports[name+"/"+strconv.Itoa(argcnt)]
+	}
+	return name[0] != '_'
+}
+
+type importinfo struct {
+	path, search string
+}
+
+func (c *compiler) importChain(start int) []string {
+	xs := make([]string, 0, len(c.imports)-start+1)
+	for _, imp := range c.imports[start:] {
+		xs = append(xs, imp.path)
+	}
+	return xs
+}
+
+// Wraps the error in the module being imported with the import chain. The
+// module not found error is attributed to the importing module. The parse
+// errors keep their types, so that the callers can inspect them.
+func (c *compiler) importError(err error) error {
+	switch e := err.(type) {
+	case *importCycleError:
+		return err
+	case interface{ ImportChain() string }:
+		if e.ImportChain() != "" {
+			return err
+		}
+	}
+	chain := c.importChain(0)
+	if errors.Is(err, fs.ErrNotExist) {
+		if chain = chain[:len(chain)-1]; len(chain) == 0 {
+			return err
+		}
+	}
+	if e, ok := err.(interface{ withImportChain([]string) error }); ok {
+		return e.withImportChain(chain)
+	}
+	return &moduleImportError{err, chain}
+}
+
 func (c *compiler) compileModule(q *Query, alias string) error {
 	scope := c.scopes[len(c.scopes)-1]
 	scope.depth++
@@ -719,6 +934,15 @@ func (c *compiler) compileReduce(e *Reduce) error {
 	}
 	f()
 	c.append(&code{op: opstore, v: v})
+	// the accumulator is updated in place during the reduction
+	us, inplace := c.accumulatorUpdates(e.Update, nil)
+	var a [2]int
+	if inplace {
+		a = c.newVariable()
+		c.append(&code{op: oppush, v: nil})
+		c.append(&code{op: opcall, v: [3]any{funcAllocator, 0, "_allocator"}})
+		c.append(&code{op: opstore, v: a})
+	}
 	setfork := c.lazy(func() *code {
 		return &code{op: opfork, v: len(c.codes)}
 	})
@@ -730,7 +954,11 @@ func (c *compiler) compileReduce(e *Reduce) error {
 	}
 	c.append(&code{op: opload, v: v})
 	f = c.newScopeDepth()
-	if err := c.compileQuery(e.Update); err != nil {
+	if inplace {
+		if err := c.compileAccumulatorUpdates(us, a); err != nil {
+			return err
+		}
+	} else if err := c.compileQuery(e.Update); err != nil {
 		return err
 	}
 	f()
@@ -759,9 +987,22 @@ func (c *compiler) compileForeach(e *Foreach) error {
 	if _, err := c.compilePattern(nil, e.Pattern); err != nil {
 		return err
 	}
+	// the state is emitted on each iteration, so allocate on each iteration
+	us, inplace := c.accumulatorUpdates(e.Update, nil)
+	var a [2]int
+	if inplace {
+		a = c.newVariable()
+		c.append(&code{op: oppush, v: nil})
+		c.append(&code{op: opcall, v: [3]any{funcAllocator, 0, "_allocator"}})
+		c.append(&code{op: opstore, v: a})
+	}
 	c.append(&code{op: opload, v: v})
 	f = c.newScopeDepth()
-	if err := c.compileQuery(e.Update); err != nil {
+	if inplace {
+		if err := c.compileAccumulatorUpdates(us, a); err != nil {
+			return err
+		}
+	} else if err := c.compileQuery(e.Update); err != nil {
 		return err
 	}
 	f()
@@ -895,6 +1136,9 @@ func (c *compiler) compileFunc(e *Func) error {
 			}
 			return nil
 		} else if e.Name == "$ENV" || e.Name == "env" {
+			if c.prelude {
+				return &funcNotInPreludeError{e}
+			}
 			env := make(map[string]any)
 			if c.environLoader != nil {
 				for _, kv := range c.environLoader() {
@@ -921,6 +1165,11 @@ func (c *compiler) compileFunc(e *Func) error {
 	if f := c.lookupBuiltin(e.Name, len(e.Args)); f != nil {
 		return c.compileCallPc(f, e.Args)
 	}
+	if c.precompiled != nil {
+		if f := c.copyBuiltin(e.Name, len(e.Args)); f != nil {
+			return c.compileCallPc(f, e.Args)
+		}
+	}
 	if fds, ok := builtinFuncDefs[e.Name]; ok {
 		var compiled bool
 		for _, fd := range fds {
@@ -947,6 +1196,9 @@ func (c *compiler) compileFunc(e *Func) error {
 		}
 	}
 	if fn, ok := internalFuncs[e.Name]; ok && fn.accept(len(e.Args)) {
+		if c.prelude && fn.callback == nil && e.Name != "empty" && e.Name != "path" {
+			return &funcNotInPreludeError{e}
+		}
 		switch e.Name {
 		case "empty":
 			c.append(&code{op: opbacktrack})
@@ -966,15 +1218,33 @@ func (c *compiler) compileFunc(e *Func) error {
 				-1,
 			)
 		case "input":
+			if c.prelude {
+				return &funcNotInPreludeError{e}
+			}
 			if c.inputIter == nil {
 				return &inputNotAllowedError{}
 			}
+			c.usesInput = true
 			return c.compileCallInternal(
 				[3]any{c.funcInput, 0, e.Name},
 				e.Args,
 				true,
 				-1,
 			)
+		case "input_filename", "input_line_number", "input_offset":
+			if fn, ok := c.customFuncs[e.Name]; ok && fn.accept(len(e.Args)) {
+				break // the custom function takes precedence
+			}
+			// the metadata depends on the position of the input iterator
+			if c.inputIter != nil {
+				c.usesInput = true
+			}
+			return c.compileCallInternal(
+				[3]any{c.funcInputMetadata(e.Name), 0, e.Name},
+				e.Args,
+				true,
+				-1,
+			)
 		case "modulemeta":
 			return c.compileCallInternal(
 				[3]any{c.funcModulemeta, 0, e.Name},
@@ -998,7 +1268,17 @@ func (c *compiler) compileFunc(e *Func) error {
 			c.append(&code{op: opbacktrack})
 			setfork()
 			return nil
+		case "random", "random_int", "shuffle", "sample", "uuid4":
+			return c.compileCallInternal(
+				[3]any{c.funcRandom(e.Name), len(e.Args), e.Name},
+				e.Args,
+				true,
+				-1,
+			)
 		case "_match":
+			if c.prelude { // depends on the regular expression engine
+				return &funcNotInPreludeError{e}
+			}
 			return c.compileCallInternal(
 				[3]any{c.funcMatch, len(e.Args), e.Name},
 				e.Args,
@@ -1023,6 +1303,9 @@ func (c *compiler) compileFunc(e *Func) error {
 		}
 		return nil
 	}
+	if path, ok := c.privateFuncs[e.Name+"/"+strconv.Itoa(len(e.Args))]; ok {
+		return &funcNotExportedError{path, e}
+	}
 	return &funcNotFoundError{e}
 }
 
@@ -1213,6 +1496,31 @@ func (c *compiler) funcInput(any, []any) any {
 	return v
 }
 
+func (c *compiler) funcInputMetadata(name string) func(any, []any) any {
+	return func(any, []any) any {
+		iter, ok := c.inputIter.(InputMetadataIter)
+		if !ok {
+			return nil
+		}
+		m := iter.InputMetadata()
+		switch name {
+		case "input_filename":
+			if m.Filename != "" {
+				return m.Filename
+			}
+		case "input_line_number":
+			if m.Line > 0 {
+				return m.Line
+			}
+		default:
+			if m.Offset >= 0 {
+				return int(m.Offset)
+			}
+		}
+		return nil
+	}
+}
+
 func (c *compiler) funcModulemeta(v any, _ []any) any {
 	s, ok := v.(string)
 	if !ok {
@@ -1221,38 +1529,35 @@ func (c *compiler) funcModulemeta(v any, _ []any) any {
 	if c.moduleLoader == nil {
 		return fmt.Errorf("cannot load module: %q", s)
 	}
-	var q *Query
-	var err error
-	if moduleLoader, ok := c.moduleLoader.(interface {
-		LoadModuleWithMeta(string, map[string]any) (*Query, error)
-	}); ok {
-		if q, err = moduleLoader.LoadModuleWithMeta(s, nil); err != nil {
-			return err
-		}
-	} else if moduleLoader, ok := c.moduleLoader.(interface {
-		LoadModule(string) (*Query, error)
-	}); ok {
-		if q, err = moduleLoader.LoadModule(s); err != nil {
-			return err
-		}
+	moduleLoader := toModuleQueryLoader(c.moduleLoader)
+	if moduleLoader == nil {
+		return &moduleNotFoundError{s}
+	}
+	q, err := moduleLoader.LoadModuleWithMeta(s, nil)
+	if err != nil {
+		return err
 	}
 	meta := q.Meta.ToValue()
 	if meta == nil {
 		meta = make(map[string]any)
 	}
-	meta["defs"] = listModuleDefs(q)
+	exports, err := moduleExports(q)
+	if err != nil {
+		return err
+	}
+	meta["defs"] = listModuleDefs(q, exports)
 	meta["deps"] = listModuleDeps(q)
 	return meta
 }
 
-func listModuleDefs(q *Query) []any {
+func listModuleDefs(q *Query, exports map[string]bool) []any {
 	type funcNameArity struct {
 		name  string
 		arity int
 	}
 	var xs []*funcNameArity
 	for _, fd := range q.FuncDefs {
-		if fd.Name[0] != '_' {
+		if isModuleExport(fd.Name, len(fd.Args), exports) {
 			xs = append(xs, &funcNameArity{fd.Name, len(fd.Args)})
 		}
 	}
@@ -1289,7 +1594,38 @@ func listModuleDeps(q *Query) []any {
 }
 
 func (c *compiler) funcMatch(v any, args []any) any {
-	return funcMatch(v, args[0], args[1], args[2], &c.regexpCache)
+	engine := c.regexpEngine
+	if engine == nil {
+		engine = defaultRegexpEngine
+	}
+	return funcMatch(v, args[0], args[1], args[2], engine, &c.regexpCache)
+}
+
+func (c *compiler) funcRandom(name string) func(any, []any) any {
+	if c.rand == nil {
+		if c.randSource == nil {
+			c.randSource = rand.NewPCG(rand.Uint64(), rand.Uint64())
+		}
+		c.rand = rand.New(c.randSource)
+	}
+	var f func(any, []any, *rand.Rand) any
+	switch name {
+	case "random":
+		f = funcRandom
+	case "random_int":
+		f = funcRandomInt
+	case "shuffle":
+		f = funcShuffle
+	case "sample":
+		f = funcSample
+	case "uuid4":
+		f = funcUUID4
+	}
+	return func(v any, args []any) any {
+		c.randMutex.Lock()
+		defer c.randMutex.Unlock()
+		return f(v, args, c.rand)
+	}
 }
 
 func (c *compiler) compileObject(e *Object) error {
@@ -1484,6 +1820,20 @@ func formatToFunc(format string) *Func {
 		return &Func{Name: "_tobase64"}
 	case "@base64d":
 		return &Func{Name: "_tobase64d"}
+	case "@base64url":
+		return &Func{Name: "_tobase64url"}
+	case "@base64urld":
+		return &Func{Name: "_tobase64urld"}
+	case "@base32":
+		return &Func{Name: "_tobase32"}
+	case "@base32d":
+		return &Func{Name: "_tobase32d"}
+	case "@hex":
+		return &Func{Name: "_tohex"}
+	case "@hexd":
+		return &Func{Name: "_tohexd"}
+	case "@sql":
+		return &Func{Name: "_tosql"}
 	default:
 		return nil
 	}
@@ -1706,8 +2056,8 @@ func (c *compiler) optimizeCodeOps() {
 		case opjump, opjumpifnot:
 			if j := code.v.(int); j-1 == i {
 				code.op = opnop
-			} else if next = c.codes[j]; next.op == opjump {
-				code.v = next.v
+			} else if j < len(c.codes) && c.codes[j].op == opjump {
+				code.v = c.codes[j].v
 			}
 		}
 		next = code
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -276,6 +277,35 @@ func TestCodeCompile_OptimizeJumps(t *testing.T) {
 	}
 }
 
+func TestCodeCompile_Prelude(t *testing.T) {
+	compile := func(src string) reflect.Value {
+		query, err := gojq.Parse(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := gojq.Compile(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reflect.ValueOf(code).Elem().FieldByName("codes")
+	}
+	codes1 := compile("0 | while(. < 10; . + 1)")
+	codes2 := compile("0 | while(. < 10; . + 1)")
+	if got, expected := codes2.Len(), codes1.Len(); expected != got {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+	for i := range codes1.Len() {
+		if codes1.Index(i).Pointer() == codes2.Index(i).Pointer() {
+			t.Errorf("expected codes not to be shared: %d", i)
+		}
+	}
+	// the built-in function is copied only once
+	if got, expected := compile("map(.) | map(.)").Len()-compile("map(.)").Len(),
+		compile("def f(g): g; f(.) | f(.)").Len()-compile("def f(g): g; f(.)").Len(); expected != got {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+}
+
 func TestParseErrorTokenOffset(t *testing.T) {
 	testCases := []struct {
 		src    string
@@ -374,6 +404,60 @@ func TestCodeRun_RaceRegexp(t *testing.T) {
 	wg.Wait()
 }
 
+func TestCodeRun_ReduceInPlace(t *testing.T) {
+	// compares the results with the updates not applied in place (`| .` disables)
+	run := func(src string, v any) []any {
+		query, err := gojq.Parse(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := gojq.Compile(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var xs []any
+		iter := code.Run(v)
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				xs = append(xs, err.Error())
+				break
+			}
+			xs = append(xs, v)
+		}
+		return xs
+	}
+	inputs := []any{nil, 1, []any{1, 2}, map[string]any{"a": []any{1}, "b": map[string]any{}}}
+	for _, query := range []string{
+		`reduce range(4) as $x (.; UPDATE)`,
+		`reduce range(4) as $x ({a: {b: []}, s: ""}; UPDATE) | [., .]`,
+		`. as $y | reduce range(4) as $x ($y; .c = $y | UPDATE) | [., $y]`,
+		`[foreach range(4) as $x ({a: [], s: ""}; UPDATE; ., .)]`,
+		`[limit(3; foreach range(4) as $x (.; UPDATE))]`,
+		`path(reduce range(2) as $x (.; UPDATE))`,
+	} {
+		for _, update := range []string{
+			`.[$x|tostring] = $x`, `.a += [$x]`, `.a += {"k\($x)": [$x]}`,
+			`.s += "\($x)"`, `. + [$x]`, `. + {"\($x)": $x}`, `.[$x] += 1`,
+			`.a.b += [$x] | .c = .a | .a.b += [$x]`, `.a |= . + [$x] | .b |= [.]`,
+			`.a += [[$x]] | .a[0] += [$x] | .a |= [., .] | .a[0][0] += [$x]`,
+			`.a += [$x] | .a |= .[1:] | .a += [$x]`, `.a[-2] = $x`, `.x -= $x`,
+			`.a = (if $x > 2 then error("\($x)") else [$x] end) | .a += [$x]`,
+		} {
+			src := strings.ReplaceAll(query, "UPDATE", update)
+			for _, v := range inputs {
+				got, expected := run(src, v), run(strings.ReplaceAll(query, "UPDATE", update+" | ."), v)
+				if !reflect.DeepEqual(got, expected) {
+					t.Errorf("%s on %v\n  expected: %v\n       got: %v", src, v, expected, got)
+				}
+			}
+		}
+	}
+}
+
 func BenchmarkCompile(b *testing.B) {
 	cnt, err := os.ReadFile("builtin.jq")
 	if err != nil {
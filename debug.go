@@ -59,6 +59,14 @@ func (c *compiler) deleteCodeInfo(name string) {
 	}
 }
 
+func (c *compiler) copyCodeInfos(p *compiler, start, end, offset int) {
+	for _, ci := range p.codeinfos {
+		if start <= ci.pc && ci.pc < end {
+			c.codeinfos = append(c.codeinfos, codeinfo{ci.name, ci.pc + offset})
+		}
+	}
+}
+
 func (env *env) lookupInfoName(pc int) string {
 	var name string
 	for _, ci := range env.codeinfos {
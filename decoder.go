@@ -0,0 +1,668 @@
+package gojq
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Decoder reads and decodes JSON values from an input stream into the values
+// gojq handles (nil, bool, int, float64, *big.Int, json.Number, string, []any,
+// and map[string]any). This is the decoder used by gojq command, and is more
+// efficient than json.Decoder in the Go standard library since it does not
+// rely on reflection.
+//
+// The integers are decoded to int, or *big.Int when they exceed the range of
+// int. Other numbers are decoded to json.Number so that they are encoded as
+// they are in the input, like 1.0 and 1e1000. The byte order mark at the
+// beginning of the stream is skipped. When the decoder fails to decode the
+// input, it returns a [*DecodeError].
+//
+// Like json.Decoder, the decoder also provides the token API ([*Decoder.Token]
+// and [*Decoder.More]) to read the JSON values in the token stream, which can
+// be mixed with [*Decoder.Decode] and [*Decoder.DecodeRaw] to decode the
+// values in arrays and objects.
+type Decoder struct {
+	r          io.Reader
+	buf        []byte
+	pos        int   // position of the next token in buf
+	offset     int64 // offset of buf in the input stream
+	err        error // error on reading the input stream
+	mark       int   // position in buf kept on filling, or -1
+	depth      int   // nesting depth of the arrays and objects being decoded
+	nonFinite  bool
+	tokenState int
+	tokenStack []int
+}
+
+const (
+	tokenTopValue = iota
+	tokenArrayStart
+	tokenArrayValue
+	tokenArrayComma
+	tokenObjectStart
+	tokenObjectKey
+	tokenObjectColon
+	tokenObjectValue
+	tokenObjectComma
+)
+
+// decoderMaxDepth is the maximum nesting depth of the arrays and objects, which
+// is the same as encoding/json.
+const decoderMaxDepth = 10000
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, buf: make([]byte, 0, 16*1024), mark: -1}
+}
+
+// AllowNonFinite allows the decoder to accept the non-finite number literals
+// NaN, nan, Infinity, and -Infinity, like jq does. NaN is decoded to
+// math.NaN(), and infinities are decoded to math.Inf(±1).
+func (d *Decoder) AllowNonFinite() {
+	d.nonFinite = true
+}
+
+// InputOffset returns the offset of the end of the last decoded value in the
+// input stream.
+func (d *Decoder) InputOffset() int64 {
+	return d.offset + int64(d.pos)
+}
+
+// Decode reads and returns the next JSON value from the input stream. It
+// returns io.EOF when there are no more values in the stream.
+func (d *Decoder) Decode() (any, error) {
+	if err := d.prepareValue(); err != nil {
+		return nil, err
+	}
+	v, err := d.decodeValue()
+	if err != nil {
+		return nil, err
+	}
+	d.tokenValueEnd()
+	return v, nil
+}
+
+// DecodeRaw reads the next JSON value from the input stream, and returns the
+// bytes of the value without building the value, like decoding to
+// [json.RawMessage]. Note that the bytes can contain the non-finite number
+// literals when [*Decoder.AllowNonFinite] is called. It returns io.EOF when
+// there are no more values in the stream.
+func (d *Decoder) DecodeRaw() ([]byte, error) {
+	raw, _, err := d.decodeRaw()
+	return raw, err
+}
+
+// DecodeLazy reads the next JSON value from the input stream, and returns the
+// value decoded on demand by [*Code.Run], like [json.RawMessage] but the bytes
+// are not validated again on running the code. The value is only for passing
+// to [*Code.Run] as the input or a variable value. The values containing the
+// non-finite number literals are decoded in advance. It returns io.EOF when
+// there are no more values in the stream.
+func (d *Decoder) DecodeLazy() (any, error) {
+	raw, valid, err := d.decodeRaw()
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		dec := NewDecoder(bytes.NewReader(raw))
+		dec.nonFinite = true
+		return dec.Decode()
+	}
+	return validRawJSON(raw), nil
+}
+
+// decodeRaw returns the bytes of the next value, and whether the bytes are
+// valid JSON, which do not contain the non-finite number literals.
+func (d *Decoder) decodeRaw() ([]byte, bool, error) {
+	if err := d.prepareValue(); err != nil {
+		return nil, false, err
+	}
+	d.mark = d.pos
+	defer func() { d.mark = -1 }()
+	valid := true
+	for depth := len(d.tokenStack); ; {
+		t, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = d.eofError()
+			}
+			return nil, false, err
+		}
+		if _, ok := t.(float64); ok { // only the non-finite numbers are float64
+			valid = false
+		}
+		switch t {
+		case json.Delim('['), json.Delim('{'):
+			continue
+		case json.Delim(']'), json.Delim('}'):
+		default:
+			if d.tokenState == tokenObjectColon {
+				continue
+			}
+		}
+		if len(d.tokenStack) == depth {
+			return slices.Clone(d.buf[d.mark:d.pos]), valid, nil
+		}
+	}
+}
+
+// Token returns the next JSON token in the input stream. The token is one of
+// [json.Delim] for the brackets and braces, and the values of the literals,
+// strings, and numbers (decoded like [*Decoder.Decode]). The commas and colons
+// are validated and skipped. It returns io.EOF at the end of the stream.
+func (d *Decoder) Token() (any, error) {
+	d.skipBOM()
+	for {
+		if !d.skipSpace() {
+			if d.tokenState == tokenTopValue && len(d.tokenStack) == 0 && d.err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, d.eofError()
+		}
+		switch c := d.buf[d.pos]; c {
+		case '[', '{':
+			if !d.tokenValueAllowed() {
+				return nil, d.tokenError()
+			}
+			if len(d.tokenStack) >= decoderMaxDepth {
+				return nil, d.depthError()
+			}
+			d.pos++
+			d.tokenStack = append(d.tokenStack, d.tokenState)
+			if c == '[' {
+				d.tokenState = tokenArrayStart
+			} else {
+				d.tokenState = tokenObjectStart
+			}
+			return json.Delim(c), nil
+		case ']', '}':
+			if c == ']' && d.tokenState != tokenArrayStart && d.tokenState != tokenArrayComma ||
+				c == '}' && d.tokenState != tokenObjectStart && d.tokenState != tokenObjectComma {
+				return nil, d.tokenError()
+			}
+			d.pos++
+			d.tokenState = d.tokenStack[len(d.tokenStack)-1]
+			d.tokenStack = d.tokenStack[:len(d.tokenStack)-1]
+			d.tokenValueEnd()
+			return json.Delim(c), nil
+		case ':':
+			if d.tokenState != tokenObjectColon {
+				return nil, d.tokenError()
+			}
+			d.pos++
+			d.tokenState = tokenObjectValue
+		case ',':
+			switch d.tokenState {
+			case tokenArrayComma:
+				d.tokenState = tokenArrayValue
+			case tokenObjectComma:
+				d.tokenState = tokenObjectKey
+			default:
+				return nil, d.tokenError()
+			}
+			d.pos++
+		default:
+			if d.tokenState == tokenObjectStart || d.tokenState == tokenObjectKey {
+				if c != '"' {
+					return nil, d.tokenError()
+				}
+				k, err := d.decodeString()
+				if err != nil {
+					return nil, err
+				}
+				d.tokenState = tokenObjectColon
+				return k, nil
+			}
+			if !d.tokenValueAllowed() {
+				return nil, d.tokenError()
+			}
+			v, err := d.decodeValue()
+			if err != nil {
+				return nil, err
+			}
+			d.tokenValueEnd()
+			return v, nil
+		}
+	}
+}
+
+// More reports whether there is another element in the current array or
+// object being read by the token API.
+func (d *Decoder) More() bool {
+	d.skipBOM()
+	if !d.skipSpace() {
+		return false
+	}
+	c := d.buf[d.pos]
+	return c != ']' && c != '}'
+}
+
+// skipBOM skips the byte order mark at the beginning of the stream. This reads
+// the bytes only while they match the mark, not to wait for the bytes of
+// a short value like "1\n" on an interactive input.
+func (d *Decoder) skipBOM() {
+	if d.offset != 0 || d.pos != 0 {
+		return
+	}
+	const bom = "\xEF\xBB\xBF"
+	for i := range len(bom) {
+		if !d.ensure(i+1) || d.buf[i] != bom[i] {
+			return
+		}
+	}
+	d.pos = len(bom)
+}
+
+// prepareValue skips the comma or the colon before the value read by
+// [*Decoder.Decode] or [*Decoder.DecodeRaw] in the token stream.
+func (d *Decoder) prepareValue() error {
+	d.skipBOM()
+	for {
+		if !d.skipSpace() {
+			if len(d.tokenStack) > 0 {
+				return d.eofError()
+			}
+			if d.err == io.EOF {
+				return io.EOF
+			}
+			return d.err
+		}
+		switch c := d.buf[d.pos]; {
+		case c == ',' && d.tokenState == tokenArrayComma:
+			d.tokenState = tokenArrayValue
+		case c == ':' && d.tokenState == tokenObjectColon:
+			d.tokenState = tokenObjectValue
+		case d.tokenValueAllowed():
+			return nil
+		default:
+			return d.tokenError()
+		}
+		d.pos++
+	}
+}
+
+func (d *Decoder) tokenValueAllowed() bool {
+	switch d.tokenState {
+	case tokenTopValue, tokenArrayStart, tokenArrayValue, tokenObjectValue:
+		return true
+	}
+	return false
+}
+
+func (d *Decoder) tokenValueEnd() {
+	switch d.tokenState {
+	case tokenArrayStart, tokenArrayValue:
+		d.tokenState = tokenArrayComma
+	case tokenObjectValue:
+		d.tokenState = tokenObjectComma
+	}
+}
+
+func (d *Decoder) tokenError() error {
+	switch d.tokenState {
+	case tokenArrayComma:
+		return d.syntaxError(0, "after array element")
+	case tokenObjectStart, tokenObjectKey:
+		return d.syntaxError(0, "looking for beginning of object key string")
+	case tokenObjectColon:
+		return d.syntaxError(0, "after object key")
+	case tokenObjectComma:
+		return d.syntaxError(0, "after object key:value pair")
+	default:
+		return d.syntaxError(0, "looking for beginning of value")
+	}
+}
+
+// DecodeError represents an error on decoding JSON values.
+type DecodeError struct {
+	Offset int64 // the error occurred after reading Offset bytes
+	msg    string
+	eof    bool
+}
+
+func (err *DecodeError) Error() string {
+	return err.msg
+}
+
+// Unwrap returns io.ErrUnexpectedEOF when the input stream ends in the middle
+// of a JSON value.
+func (err *DecodeError) Unwrap() error {
+	if err.eof {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// fill reads more bytes from the input stream, discarding the bytes before
+// the position of the current token (or the mark of [*Decoder.DecodeRaw]).
+func (d *Decoder) fill() bool {
+	if d.err != nil {
+		return false
+	}
+	if n := d.pos; n > 0 && d.mark != 0 {
+		if d.mark > 0 {
+			n = d.mark
+			d.mark = 0
+		}
+		d.offset += int64(n)
+		d.buf = d.buf[:copy(d.buf, d.buf[n:])]
+		d.pos -= n
+	}
+	if len(d.buf) == cap(d.buf) {
+		d.buf = append(d.buf, make([]byte, len(d.buf))...)[:len(d.buf)]
+	}
+	for {
+		n, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+		d.buf = d.buf[:len(d.buf)+n]
+		if err != nil {
+			d.err = err
+			return n > 0
+		}
+		if n > 0 {
+			return true
+		}
+	}
+}
+
+// ensure reports whether n bytes from the current position are available.
+func (d *Decoder) ensure(n int) bool {
+	for d.pos+n > len(d.buf) {
+		if !d.fill() {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Decoder) skipSpace() bool {
+	for {
+		for ; d.pos < len(d.buf); d.pos++ {
+			switch d.buf[d.pos] {
+			case ' ', '\t', '\n', '\r':
+			default:
+				return true
+			}
+		}
+		if !d.fill() {
+			return false
+		}
+	}
+}
+
+func (d *Decoder) decodeValue() (any, error) {
+	if !d.skipSpace() {
+		return nil, d.eofError()
+	}
+	switch c := d.buf[d.pos]; c {
+	case '{':
+		return d.decodeObject()
+	case '[':
+		return d.decodeArray()
+	case '"':
+		return d.decodeString()
+	case 't':
+		return true, d.decodeLiteral("true")
+	case 'f':
+		return false, d.decodeLiteral("false")
+	case 'n':
+		if d.nonFinite && d.ensure(2) && d.buf[d.pos+1] == 'a' {
+			return math.NaN(), d.decodeLiteral("nan")
+		}
+		return nil, d.decodeLiteral("null")
+	case 'N':
+		if d.nonFinite {
+			return math.NaN(), d.decodeLiteral("NaN")
+		}
+	case 'I':
+		if d.nonFinite {
+			return math.Inf(1), d.decodeLiteral("Infinity")
+		}
+	default:
+		if c == '-' || '0' <= c && c <= '9' {
+			if c == '-' && d.nonFinite && d.ensure(2) && d.buf[d.pos+1] == 'I' {
+				return math.Inf(-1), d.decodeLiteral("-Infinity")
+			}
+			return d.decodeNumber()
+		}
+	}
+	return nil, d.syntaxError(0, "looking for beginning of value")
+}
+
+func (d *Decoder) decodeObject() (any, error) {
+	if d.depth++; len(d.tokenStack)+d.depth > decoderMaxDepth {
+		return nil, d.depthError()
+	}
+	defer func() { d.depth-- }()
+	d.pos++
+	m := map[string]any{}
+	if !d.skipSpace() {
+		return nil, d.eofError()
+	}
+	if d.buf[d.pos] == '}' {
+		d.pos++
+		return m, nil
+	}
+	for {
+		if d.buf[d.pos] != '"' {
+			return nil, d.syntaxError(0, "looking for beginning of object key string")
+		}
+		k, err := d.decodeString()
+		if err != nil {
+			return nil, err
+		}
+		if !d.skipSpace() {
+			return nil, d.eofError()
+		}
+		if d.buf[d.pos] != ':' {
+			return nil, d.syntaxError(0, "after object key")
+		}
+		d.pos++
+		v, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		m[k.(string)] = v
+		if !d.skipSpace() {
+			return nil, d.eofError()
+		}
+		switch d.buf[d.pos] {
+		case ',':
+			d.pos++
+			if !d.skipSpace() {
+				return nil, d.eofError()
+			}
+		case '}':
+			d.pos++
+			return m, nil
+		default:
+			return nil, d.syntaxError(0, "after object key:value pair")
+		}
+	}
+}
+
+func (d *Decoder) decodeArray() (any, error) {
+	if d.depth++; len(d.tokenStack)+d.depth > decoderMaxDepth {
+		return nil, d.depthError()
+	}
+	defer func() { d.depth-- }()
+	d.pos++
+	a := []any{}
+	if !d.skipSpace() {
+		return nil, d.eofError()
+	}
+	if d.buf[d.pos] == ']' {
+		d.pos++
+		return a, nil
+	}
+	for {
+		v, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+		if !d.skipSpace() {
+			return nil, d.eofError()
+		}
+		switch d.buf[d.pos] {
+		case ',':
+			d.pos++
+		case ']':
+			d.pos++
+			return a, nil
+		default:
+			return nil, d.syntaxError(0, "after array element")
+		}
+	}
+}
+
+func (d *Decoder) decodeString() (any, error) {
+	var escaped bool
+	for i := 1; ; i++ {
+		if d.pos+i >= len(d.buf) && !d.ensure(i+1) {
+			return nil, d.eofError()
+		}
+		switch c := d.buf[d.pos+i]; {
+		case c == '"':
+			s := d.buf[d.pos : d.pos+i+1]
+			d.pos += i + 1
+			if !escaped && utf8.Valid(s) {
+				return string(s[1 : len(s)-1]), nil
+			}
+			var v string
+			_ = json.Unmarshal(s, &v)
+			return v, nil
+		case c == '\\':
+			escaped = true
+			if i++; !d.ensure(i + 1) {
+				return nil, d.eofError()
+			}
+			switch d.buf[d.pos+i] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case 'u':
+				for j := 0; j < 4; j++ {
+					if i++; !d.ensure(i + 1) {
+						return nil, d.eofError()
+					}
+					if !isHexDigit(d.buf[d.pos+i]) {
+						return nil, d.syntaxError(i, `in \u hexadecimal character escape`)
+					}
+				}
+			default:
+				return nil, d.syntaxError(i, "in string escape code")
+			}
+		case c < ' ':
+			return nil, d.syntaxError(i, "in string literal")
+		}
+	}
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func (d *Decoder) decodeLiteral(s string) error {
+	for i := 1; i < len(s); i++ {
+		if !d.ensure(i + 1) {
+			return d.eofError()
+		}
+		if d.buf[d.pos+i] != s[i] {
+			return d.syntaxError(i, "in literal "+s+" (expecting "+quoteChar(s[i])+")")
+		}
+	}
+	d.pos += len(s)
+	return nil
+}
+
+func (d *Decoder) decodeNumber() (any, error) {
+	// peek returns the byte at i, or 0 at the end of the input stream
+	peek := func(i int) byte {
+		if d.pos+i < len(d.buf) || d.ensure(i+1) {
+			return d.buf[d.pos+i]
+		}
+		return 0
+	}
+	digits := func(i int, msg string) (int, error) {
+		if c := peek(i); c < '0' || '9' < c {
+			if d.pos+i >= len(d.buf) {
+				return 0, d.eofError()
+			}
+			return 0, d.syntaxError(i, msg)
+		}
+		for i++; '0' <= peek(i) && peek(i) <= '9'; i++ {
+		}
+		return i, nil
+	}
+	var i int
+	if peek(0) == '-' {
+		i++
+	}
+	var err error
+	if peek(i) == '0' {
+		i++
+	} else if i, err = digits(i, "in numeric literal"); err != nil {
+		return nil, err
+	}
+	isInt := true
+	if peek(i) == '.' {
+		isInt = false
+		if i, err = digits(i+1, "after decimal point in numeric literal"); err != nil {
+			return nil, err
+		}
+	}
+	if c := peek(i); c == 'e' || c == 'E' {
+		isInt = false
+		if c := peek(i + 1); c == '+' || c == '-' {
+			i++
+		}
+		if i, err = digits(i+1, "in exponent of numeric literal"); err != nil {
+			return nil, err
+		}
+	}
+	s := string(d.buf[d.pos : d.pos+i])
+	d.pos += i
+	if isInt && s != "-0" {
+		if v, err := strconv.ParseInt(s, 10, 0); err == nil {
+			return int(v), nil
+		}
+		if v, ok := new(big.Int).SetString(s, 10); ok {
+			return v, nil
+		}
+	}
+	return json.Number(s), nil
+}
+
+// syntaxError returns an error of the invalid byte at i from the position.
+func (d *Decoder) syntaxError(i int, msg string) error {
+	return &DecodeError{
+		Offset: d.offset + int64(d.pos+i) + 1,
+		msg:    "invalid character " + quoteChar(d.buf[d.pos+i]) + " " + msg,
+	}
+}
+
+func (d *Decoder) depthError() error {
+	return &DecodeError{Offset: d.offset + int64(d.pos) + 1, msg: "exceeded max depth"}
+}
+
+func (d *Decoder) eofError() error {
+	if d.err != nil && d.err != io.EOF {
+		return d.err
+	}
+	return &DecodeError{Offset: d.offset + int64(len(d.buf)), msg: "unexpected EOF", eof: true}
+}
+
+func quoteChar(c byte) string {
+	if c == '\'' {
+		return `'\''`
+	}
+	if c == '"' {
+		return `'"'`
+	}
+	s := strconv.Quote(string(rune(c)))
+	return "'" + s[1:len(s)-1] + "'"
+}
@@ -0,0 +1,363 @@
+package gojq_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/itchyny/gojq"
+)
+
+func ExampleDecoder() {
+	dec := gojq.NewDecoder(strings.NewReader(`{"a": 1, "b": [1.0, 1e1000]} NaN`))
+	dec.AllowNonFinite()
+	for {
+		v, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("%#v\n", v)
+	}
+
+	// Output:
+	// map[string]interface {}{"a":1, "b":[]interface {}{"1.0", "1e1000"}}
+	// NaN
+}
+
+func TestDecoder(t *testing.T) {
+	for _, input := range []string{
+		`null`, `true`, `false`, `0`, `-0`, `1`, `-128`, `0.5`, `-1.0`, `1e3`, `1E+3`,
+		`1e-3`, `9223372036854775807`, `9223372036854775808`, `-9223372036854775809`,
+		`100000000000000000000000000000`, `""`, `"abc"`, `"a\"b\\c\/d\b\f\n\r\t"`,
+		`"あ😀"`, `"\ud83d"`, `"あいう"`, "\"\xff\"", `[]`, `[1, [2, [3]]]`,
+		`{}`, `{"a": 1, "b": {"c": [true, null]}}`, `{"a": 1, "a": 2}`,
+		` [ 1 , { "a" : "b" } ] `, "\n\t{\r\n\"a\":[]}\n",
+	} {
+		t.Run(input, func(t *testing.T) {
+			got, err := gojq.NewDecoder(strings.NewReader(input)).Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var expected any
+			if err := json.Unmarshal([]byte(input), &expected); err != nil {
+				t.Fatal(err)
+			}
+			if gojq.Compare(got, expected) != 0 {
+				t.Errorf("expected: %#v, got: %#v", expected, got)
+			}
+		})
+	}
+}
+
+func TestDecoderNumbers(t *testing.T) {
+	dec := gojq.NewDecoder(strings.NewReader(
+		`0 -1 1.0 -0 1e1000 9223372036854775808`))
+	var got []any
+	for {
+		v, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v)
+	}
+	bigInt, _ := new(big.Int).SetString("9223372036854775808", 10)
+	expected := []any{
+		0, -1, json.Number("1.0"), json.Number("-0"), json.Number("1e1000"), bigInt,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %#v, got: %#v", expected, got)
+	}
+}
+
+func TestDecoderNonFinite(t *testing.T) {
+	dec := gojq.NewDecoder(strings.NewReader(`[NaN, nan, Infinity, -Infinity, null, -1]`))
+	dec.AllowNonFinite()
+	v, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs := v.([]any)
+	if x := xs[0].(float64); !math.IsNaN(x) {
+		t.Errorf("expected NaN, got: %v", x)
+	}
+	if x := xs[1].(float64); !math.IsNaN(x) {
+		t.Errorf("expected NaN, got: %v", x)
+	}
+	if expected := []any{math.Inf(1), math.Inf(-1), nil, -1}; !reflect.DeepEqual(xs[2:], expected) {
+		t.Errorf("expected: %v, got: %v", expected, xs[2:])
+	}
+	_, err = gojq.NewDecoder(strings.NewReader(`NaN`)).Decode()
+	if expected := `invalid character 'N' looking for beginning of value`; err == nil || err.Error() != expected {
+		t.Errorf("expected: %v, got: %v", expected, err)
+	}
+}
+
+func TestDecoderBOM(t *testing.T) {
+	dec := gojq.NewDecoder(strings.NewReader("\xEF\xBB\xBF{\"a\": 1} \xEF\xBB\xBF"))
+	v, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]any{"a": 1}; !reflect.DeepEqual(v, expected) {
+		t.Errorf("expected: %v, got: %v", expected, v)
+	}
+	if _, err = dec.Decode(); err == nil {
+		t.Errorf("should be an error for BOM in the middle of the stream")
+	}
+}
+
+func TestDecoderShortInput(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	go w.Write([]byte("1\n"))
+	v, err := gojq.NewDecoder(r).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 1; v != expected {
+		t.Errorf("expected: %v, got: %v", expected, v)
+	}
+}
+
+func TestDecoderStream(t *testing.T) {
+	var sb strings.Builder
+	for i := range 10000 {
+		fmt.Fprintf(&sb, `{"i": %d, "s": "%s"}`+"\n", i, strings.Repeat("x", i%100))
+	}
+	dec := gojq.NewDecoder(iotest.OneByteReader(strings.NewReader(sb.String())))
+	for i := 0; ; i++ {
+		v, err := dec.Decode()
+		if err == io.EOF {
+			if i != 10000 {
+				t.Errorf("expected 10000 values, got: %d", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]any{"i": i, "s": strings.Repeat("x", i%100)}
+		if !reflect.DeepEqual(v, expected) {
+			t.Fatalf("expected: %v, got: %v", expected, v)
+		}
+	}
+	if got, expected := dec.InputOffset(), int64(sb.Len()); got != expected {
+		t.Errorf("expected offset: %d, got: %d", expected, got)
+	}
+}
+
+func TestDecoderToken(t *testing.T) {
+	dec := gojq.NewDecoder(strings.NewReader(
+		"\xEF\xBB\xBF" + `{"a": [1, NaN, {"b": null}], "c": [], "d": {"e": 2}} 3`))
+	dec.AllowNonFinite()
+	var got []any
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f, ok := tok.(float64); ok && math.IsNaN(f) {
+			tok = "NaN"
+		}
+		got = append(got, tok)
+		if tok == "d" {
+			v, err := dec.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, v, dec.More())
+		}
+	}
+	expected := []any{
+		json.Delim('{'), "a", json.Delim('['), 1, "NaN", json.Delim('{'), "b", nil,
+		json.Delim('}'), json.Delim(']'), "c", json.Delim('['), json.Delim(']'),
+		"d", map[string]any{"e": 2}, false, json.Delim('}'), 3,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+}
+
+func TestDecoderTokenError(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected string
+	}{
+		{`]`, `invalid character ']' looking for beginning of value`},
+		{`{1:2}`, `invalid character '1' looking for beginning of object key string`},
+		{`{"a" 1}`, `invalid character '1' after object key`},
+		{`{"a":1 "b":2}`, `invalid character '"' after object key:value pair`},
+		{`[1 2]`, `invalid character '2' after array element`},
+		{`[1,]`, `invalid character ']' looking for beginning of value`},
+		{`[1}`, `invalid character '}' after array element`},
+		{`[1,`, `unexpected EOF`},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			dec := gojq.NewDecoder(strings.NewReader(tc.input))
+			var err error
+			for err == nil {
+				_, err = dec.Token()
+			}
+			if err.Error() != tc.expected {
+				t.Errorf("expected: %v, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestDecoderDecodeRaw(t *testing.T) {
+	var sb strings.Builder
+	var expected []string
+	for i := range 1000 {
+		s := fmt.Sprintf(`{"i": [%d, {"s": "%s"}], "x": NaN}`, i, strings.Repeat("x", i))
+		expected = append(expected, s)
+		sb.WriteString(s + "\n")
+	}
+	dec := gojq.NewDecoder(iotest.OneByteReader(strings.NewReader(sb.String())))
+	dec.AllowNonFinite()
+	for i := 0; ; i++ {
+		raw, err := dec.DecodeRaw()
+		if err == io.EOF {
+			if i != len(expected) {
+				t.Errorf("expected %d values, got: %d", len(expected), i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(raw) != expected[i] {
+			t.Fatalf("expected: %s, got: %s", expected[i], raw)
+		}
+	}
+	dec = gojq.NewDecoder(strings.NewReader(`[1, [2, 3], {"a": 4}] [5`))
+	var got []string
+	if _, err := dec.Token(); err != nil {
+		t.Fatal(err)
+	}
+	for dec.More() {
+		raw, err := dec.DecodeRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(raw))
+	}
+	if expected := []string{`1`, `[2, 3]`, `{"a": 4}`}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+	if _, err := dec.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dec.DecodeRaw(); err == nil || err.Error() != "unexpected EOF" {
+		t.Errorf("expected: unexpected EOF, got: %v", err)
+	}
+}
+
+func TestDecoderError(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected string
+		offset   int64
+	}{
+		{`x`, `invalid character 'x' looking for beginning of value`, 1},
+		{`1 x`, `invalid character 'x' looking for beginning of value`, 3},
+		{`{1}`, `invalid character '1' looking for beginning of object key string`, 2},
+		{`{"a" 1}`, `invalid character '1' after object key`, 6},
+		{`{"a":1 "b":2}`, `invalid character '"' after object key:value pair`, 8},
+		{`{"a":1,}`, `invalid character '}' looking for beginning of object key string`, 8},
+		{`[1 2]`, `invalid character '2' after array element`, 4},
+		{`[1,]`, `invalid character ']' looking for beginning of value`, 4},
+		{`[}`, `invalid character '}' looking for beginning of value`, 2},
+		{`"\x"`, `invalid character 'x' in string escape code`, 3},
+		{`"\u12x4"`, `invalid character 'x' in \u hexadecimal character escape`, 6},
+		{"\"a\x01\"", `invalid character '\x01' in string literal`, 3},
+		{`tx`, `invalid character 'x' in literal true (expecting 'r')`, 2},
+		{`nulx`, `invalid character 'x' in literal null (expecting 'l')`, 4},
+		{`-x`, `invalid character 'x' in numeric literal`, 2},
+		{`1.x`, `invalid character 'x' after decimal point in numeric literal`, 3},
+		{`1ex`, `invalid character 'x' in exponent of numeric literal`, 3},
+		{`NaN`, `invalid character 'N' looking for beginning of value`, 1},
+		{`{`, `unexpected EOF`, 1},
+		{`{"a":1,`, `unexpected EOF`, 7},
+		{`[1`, `unexpected EOF`, 2},
+		{`"abc`, `unexpected EOF`, 4},
+		{`"\u12`, `unexpected EOF`, 5},
+		{`fals`, `unexpected EOF`, 4},
+		{`1e+`, `unexpected EOF`, 3},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			dec := gojq.NewDecoder(strings.NewReader(tc.input))
+			var err error
+			for err == nil {
+				_, err = dec.Decode()
+			}
+			if err.Error() != tc.expected {
+				t.Errorf("expected: %v, got: %v", tc.expected, err)
+			}
+			e, ok := err.(*gojq.DecodeError)
+			if !ok {
+				t.Fatalf("expected *gojq.DecodeError but got: %T", err)
+			}
+			if e.Offset != tc.offset {
+				t.Errorf("expected offset: %d, got: %d", tc.offset, e.Offset)
+			}
+			if got, expected := errors.Is(err, io.ErrUnexpectedEOF), tc.expected == "unexpected EOF"; got != expected {
+				t.Errorf("errors.Is(err, io.ErrUnexpectedEOF): expected: %v, got: %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestDecoderMaxDepth(t *testing.T) {
+	for _, decode := range []struct {
+		name string
+		f    func(*gojq.Decoder) error
+	}{
+		{"Decode", func(dec *gojq.Decoder) error { _, err := dec.Decode(); return err }},
+		{"DecodeRaw", func(dec *gojq.Decoder) error { _, err := dec.DecodeRaw(); return err }},
+		{"Token", func(dec *gojq.Decoder) error {
+			for {
+				if _, err := dec.Token(); err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
+			}
+		}},
+	} {
+		t.Run(decode.name, func(t *testing.T) {
+			input := strings.Repeat("[", 10000) + strings.Repeat("]", 10000)
+			if err := decode.f(gojq.NewDecoder(strings.NewReader(input))); err != nil {
+				t.Fatalf("should not emit an error but got: %v", err)
+			}
+			input = strings.Repeat(`{"a":[`, 1000000) + strings.Repeat("]}", 1000000)
+			err := decode.f(gojq.NewDecoder(strings.NewReader(input)))
+			if expected := "exceeded max depth"; err == nil || err.Error() != expected {
+				t.Fatalf("expected: %v, got: %v", expected, err)
+			}
+			if e, ok := err.(*gojq.DecodeError); !ok {
+				t.Fatalf("expected *gojq.DecodeError but got: %T", err)
+			} else if expected := int64(6*5000 + 1); e.Offset != expected {
+				t.Errorf("expected offset: %d, got: %d", expected, e.Offset)
+			}
+		})
+	}
+}
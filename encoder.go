@@ -16,12 +16,15 @@ import (
 // Marshal returns the jq-flavored JSON encoding of v.
 //
 // This method accepts only limited types (nil, bool, int, float64, *big.Int,
-// json.Number, string, []any, and map[string]any) because these are the
-// possible types a gojq iterator can emit. This method marshals NaN to null,
-// truncates infinities to (+|-) math.MaxFloat64, uses \b and \f in strings,
-// and does not escape '<', '>', '&', '\u2028', and '\u2029'. These behaviors
-// are based on the marshaler of jq command, and different from json.Marshal in
-// the Go standard library. Note that the result is not safe to embed in HTML.
+// json.Number, json.RawMessage, string, []any, and map[string]any) because
+// these are the possible types a gojq iterator can emit. This method marshals
+// NaN to null, truncates infinities to (+|-) math.MaxFloat64, uses \b and \f in
+// strings, and does not escape '<', '>', '&', '\u2028', and '\u2029'. These
+// behaviors are based on the marshaler of jq command, and different from
+// json.Marshal in the Go standard library. Note that the result is not safe to
+// embed in HTML. The json.RawMessage values, which are emitted for the input
+// values of the same type, are written like the decoded values without
+// building the values; the keys of the objects are sorted.
 func Marshal(v any) ([]byte, error) {
 	var b bytes.Buffer
 	(&encoder{w: &b}).encode(v)
@@ -65,6 +68,8 @@ func (e *encoder) encode(v any) {
 		e.w.Write(v.Append(e.buf[:0], 10))
 	case json.Number:
 		e.w.WriteString(v.String())
+	case json.RawMessage:
+		e.encodeRawMessage(v)
 	case string:
 		e.encodeString(v)
 	case []any:
@@ -154,6 +159,49 @@ func (e *encoder) encodeString(s string) {
 	e.w.WriteByte('"')
 }
 
+func (e *encoder) encodeRawMessage(v json.RawMessage) {
+	raw := bytes.TrimSpace(v)
+	if !json.Valid(raw) {
+		e.w.Write(v)
+		return
+	}
+	e.encodeRawJSON(raw)
+}
+
+// encodeRawJSON writes the valid JSON bytes like encoding the decoded value;
+// the insignificant spaces are removed, the keys of the objects are sorted
+// (the last value of the duplicate keys wins), and the strings are encoded.
+func (e *encoder) encodeRawJSON(raw []byte) {
+	switch raw[0] {
+	case '{':
+		xs, _ := (&lazyValue{raw: raw}).entries()
+		e.w.WriteByte('{')
+		for i, x := range xs {
+			if i > 0 {
+				e.w.WriteByte(',')
+			}
+			e.encodeString(x.path.(string))
+			e.w.WriteByte(':')
+			e.encodeRawJSON(x.value.(*lazyValue).raw)
+		}
+		e.w.WriteByte('}')
+	case '[':
+		e.w.WriteByte('[')
+		scanRawArray(raw, func(i int, x []byte) bool {
+			if i > 0 {
+				e.w.WriteByte(',')
+			}
+			e.encodeRawJSON(x)
+			return true
+		})
+		e.w.WriteByte(']')
+	case '"':
+		e.encodeString(decodeRawString(raw))
+	default:
+		e.w.Write(raw)
+	}
+}
+
 func (e *encoder) encodeArray(vs []any) {
 	e.w.WriteByte('[')
 	for i, v := range vs {
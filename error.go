@@ -1,6 +1,10 @@
 package gojq
 
-import "strconv"
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+)
 
 // ValueError is an interface for errors with a value for internal function.
 // Return an error implementing this interface when you want to catch error
@@ -27,6 +31,32 @@ func (err *expectedArrayError) Error() string {
 	return "expected an array but got: " + typeErrorPreview(err.v)
 }
 
+type expectedIntegerError struct {
+	v any
+}
+
+func (err *expectedIntegerError) Error() string {
+	return "expected an integer but got: " + typeErrorPreview(err.v)
+}
+
+type invalidPointerError struct {
+	s string
+}
+
+func (err *invalidPointerError) Error() string {
+	return "invalid JSON pointer: " + Preview(err.s)
+}
+
+type jsonpatchError struct {
+	index int
+	msg   string
+	v     any
+}
+
+func (err *jsonpatchError) Error() string {
+	return "operation " + strconv.Itoa(err.index) + ": " + err.msg + ": " + Preview(err.v)
+}
+
 type iteratorError struct {
 	v any
 }
@@ -112,6 +142,24 @@ func (err *funcNotFoundError) Error() string {
 	return "function not defined: " + err.f.Name + "/" + strconv.Itoa(len(err.f.Args))
 }
 
+type funcNotInPreludeError struct {
+	f *Func
+}
+
+func (err *funcNotInPreludeError) Error() string {
+	return "function depends on the compiler options: " + err.f.Name + "/" + strconv.Itoa(len(err.f.Args))
+}
+
+type funcNotExportedError struct {
+	path string
+	f    *Func
+}
+
+func (err *funcNotExportedError) Error() string {
+	return "function not exported by module " + strconv.Quote(err.path) + ": " +
+		err.f.Name + "/" + strconv.Itoa(len(err.f.Args))
+}
+
 type func0TypeError struct {
 	name string
 	v    any
@@ -139,6 +187,15 @@ func (err *func2TypeError) Error() string {
 	return err.name + "(" + Preview(err.w) + "; " + Preview(err.x) + ") cannot be applied to: " + typeErrorPreview(err.v)
 }
 
+type func3TypeError struct {
+	name       string
+	v, w, x, y any
+}
+
+func (err *func3TypeError) Error() string {
+	return err.name + "(" + Preview(err.w) + "; " + Preview(err.x) + "; " + Preview(err.y) + ") cannot be applied to: " + typeErrorPreview(err.v)
+}
+
 type func0WrapError struct {
 	name string
 	v    any
@@ -169,6 +226,44 @@ func (err *func2WrapError) Error() string {
 	return err.name + "(" + Preview(err.w) + "; " + Preview(err.x) + ") cannot be applied to " + Preview(err.v) + ": " + err.err.Error()
 }
 
+type func3WrapError struct {
+	name       string
+	v, w, x, y any
+	err        error
+}
+
+func (err *func3WrapError) Error() string {
+	return err.name + "(" + Preview(err.w) + "; " + Preview(err.x) + "; " + Preview(err.y) + ") cannot be applied to " + Preview(err.v) + ": " + err.err.Error()
+}
+
+// funcTypeError returns the type error of the function with variable arity.
+func funcTypeError(name string, v any, args []any) error {
+	switch len(args) {
+	case 0:
+		return &func0TypeError{name, v}
+	case 1:
+		return &func1TypeError{name, v, args[0]}
+	case 2:
+		return &func2TypeError{name, v, args[0], args[1]}
+	default:
+		return &func3TypeError{name, v, args[0], args[1], args[2]}
+	}
+}
+
+// funcWrapError wraps the error of the function with variable arity.
+func funcWrapError(name string, v any, args []any, err error) error {
+	switch len(args) {
+	case 0:
+		return &func0WrapError{name, v, err}
+	case 1:
+		return &func1WrapError{name, v, args[0], err}
+	case 2:
+		return &func2WrapError{name, v, args[0], args[1], err}
+	default:
+		return &func3WrapError{name, v, args[0], args[1], args[2], err}
+	}
+}
+
 type exitCodeError struct {
 	value any
 	code  int
@@ -261,6 +356,15 @@ func (err *zeroModuloError) Error() string {
 	return "cannot modulo " + typeErrorPreview(err.l) + " by: " + typeErrorPreview(err.r)
 }
 
+type sprintfTypeError struct {
+	spec string
+	v    any
+}
+
+func (err *sprintfTypeError) Error() string {
+	return err.spec + " expects a number but got: " + typeErrorPreview(err.v)
+}
+
 type formatNotFoundError struct {
 	n string
 }
@@ -345,9 +449,125 @@ func (err *invalidPathIterError) Error() string {
 	return "invalid path on iterating against: " + typeErrorPreview(err.v)
 }
 
+type rawJSONError struct {
+	raw []byte
+	err error
+}
+
+func (err *rawJSONError) Error() string {
+	return "invalid json: " + Preview(string(err.raw)) + ": " + err.err.Error()
+}
+
+type invalidModuleLoaderError struct {
+	typ    string
+	method string
+}
+
+func (err *invalidModuleLoaderError) Error() string {
+	if err.method != "" {
+		return "invalid module loader: " + err.typ + ": unexpected signature of " + err.method + " method"
+	}
+	return "invalid module loader: " + err.typ
+}
+
+type moduleNotFoundError struct {
+	name string
+}
+
+func (err *moduleNotFoundError) Error() string {
+	return "module not found: " + strconv.Quote(err.name)
+}
+
+func (*moduleNotFoundError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
+
+type moduleChecksumError struct {
+	name, path, expected, got string
+}
+
+func (err *moduleChecksumError) Error() string {
+	return "checksum mismatch of module " + strconv.Quote(err.name) + ": " + err.path +
+		": expected sha256 " + err.expected + " but got " + err.got
+}
+
+type moduleNotLockedError struct {
+	key string
+}
+
+func (err *moduleNotLockedError) Error() string {
+	return "module not found in lockfile: " + strconv.Quote(err.key)
+}
+
+type modulePathMismatchError struct {
+	key, expected, got string
+}
+
+func (err *modulePathMismatchError) Error() string {
+	return "module path mismatch: " + strconv.Quote(err.key) +
+		": locked to " + err.expected + " but found " + err.got
+}
+
+type importCycleError struct {
+	chain []string
+}
+
+func (err *importCycleError) Error() string {
+	return "import cycle: " + formatImportChain(err.chain)
+}
+
+type moduleExportsError struct {
+	v any
+}
+
+func (err *moduleExportsError) Error() string {
+	return "exports should be an array of strings like \"f/1\": " + typeErrorPreview(err.v)
+}
+
+type moduleImportError struct {
+	err error
+	importChain
+}
+
+func (err *moduleImportError) Error() string {
+	return err.err.Error() + err.importChain.String()
+}
+
+func (err *moduleImportError) Unwrap() error {
+	return err.err
+}
+
+// importChain is the chain of the modules being imported on an error. The
+// parse errors embed this to keep the error types with the import chain.
+type importChain []string
+
+// ImportChain returns the formatted import chain.
+func (chain importChain) ImportChain() string {
+	return formatImportChain(chain)
+}
+
+func (chain importChain) String() string {
+	if len(chain) == 0 {
+		return ""
+	}
+	return " (import chain: " + formatImportChain(chain) + ")"
+}
+
+func formatImportChain(chain []string) string {
+	var sb strings.Builder
+	for i, path := range chain {
+		if i > 0 {
+			sb.WriteString(" -> ")
+		}
+		sb.WriteString(strconv.Quote(path))
+	}
+	return sb.String()
+}
+
 type queryParseError struct {
 	fname, contents string
 	err             error
+	importChain
 }
 
 func (err *queryParseError) QueryParseError() (string, string, error) {
@@ -355,12 +575,19 @@ func (err *queryParseError) QueryParseError() (string, string, error) {
 }
 
 func (err *queryParseError) Error() string {
-	return "invalid query: " + err.fname + ": " + err.err.Error()
+	return "invalid query: " + err.fname + ": " + err.err.Error() + err.importChain.String()
+}
+
+func (err *queryParseError) withImportChain(chain []string) error {
+	e := *err
+	e.importChain = chain
+	return &e
 }
 
 type jsonParseError struct {
 	fname, contents string
 	err             error
+	importChain
 }
 
 func (err *jsonParseError) JSONParseError() (string, string, error) {
@@ -368,7 +595,41 @@ func (err *jsonParseError) JSONParseError() (string, string, error) {
 }
 
 func (err *jsonParseError) Error() string {
-	return "invalid json: " + err.fname + ": " + err.err.Error()
+	return "invalid json: " + err.fname + ": " + err.err.Error() + err.importChain.String()
+}
+
+func (err *jsonParseError) withImportChain(chain []string) error {
+	e := *err
+	e.importChain = chain
+	return &e
+}
+
+type dataParseError struct {
+	format, fname, contents string
+	err                     error
+	importChain
+}
+
+func (err *dataParseError) DataParseError() (string, string, string, error) {
+	return err.format, err.fname, err.contents, err.err
+}
+
+func (err *dataParseError) Error() string {
+	return "invalid " + err.format + ": " + err.fname + ": " + err.err.Error() + err.importChain.String()
+}
+
+func (err *dataParseError) withImportChain(chain []string) error {
+	e := *err
+	e.importChain = chain
+	return &e
+}
+
+type dataFormatError struct {
+	format string
+}
+
+func (err *dataFormatError) Error() string {
+	return "unsupported data format: " + strconv.Quote(err.format)
 }
 
 func typeErrorPreview(v any) string {
@@ -10,9 +10,17 @@ import (
 func (env *env) execute(bc *Code, v any, vars ...any) Iter {
 	env.codes = bc.codes
 	env.codeinfos = bc.codeinfos
+	v, err := toLazyValue(v)
+	if err != nil {
+		return NewIter(err)
+	}
 	env.push(v)
 	for i := len(vars) - 1; i >= 0; i-- {
-		env.push(vars[i])
+		v, err := toLazyValue(vars[i])
+		if err != nil {
+			return NewIter(err)
+		}
+		env.push(v)
 	}
 	env.debugCodes()
 	return env
@@ -60,7 +68,7 @@ loop:
 			n := code.v.(int)
 			m := make(map[string]any, n)
 			for range n {
-				v, k := env.pop(), env.pop()
+				v, k := fromLazyValue(env.pop()), fromLazyValue(env.pop())
 				s, ok := k.(string)
 				if !ok {
 					err = &objectKeyNotStringError{k}
@@ -73,7 +81,7 @@ loop:
 			env.push(m)
 		case opappend:
 			i := env.index(code.v.([2]int))
-			env.values[i] = append(env.values[i].([]any), env.pop())
+			env.values[i] = append(env.values[i].([]any), fromLazyValue(env.pop()))
 		case opfork:
 			if backtrack {
 				if err != nil {
@@ -144,27 +152,40 @@ loop:
 			if v := env.pop(); v == nil || v == false {
 				pc = code.v.(int)
 				goto loop
+			} else if v, ok := v.(*lazyValue); ok && !v.truthy() {
+				pc = code.v.(int)
+				goto loop
 			}
 		case opindex, opindexarray:
 			if backtrack {
 				break loop
 			}
 			p, v := code.v, env.pop()
-			if code.op == opindexarray && v != nil {
-				if _, ok := v.([]any); !ok {
-					err = &expectedArrayError{v}
-					break loop
+			if code.op == opindexarray {
+				if v := fromLazyValue(v); v != nil {
+					if _, ok := v.([]any); !ok {
+						err = &expectedArrayError{v}
+						break loop
+					}
 				}
 			}
-			w := funcIndex2(nil, v, p)
+			var w any
+			if x, ok := v.(*lazyValue); !ok {
+				w = funcIndex2(nil, v, p)
+			} else if w, ok = x.index(p); !ok {
+				w = funcIndex2(nil, x.get(), p)
+			}
 			if e, ok := w.(error); ok {
 				err = e
 				break loop
 			}
+			if w, err = toLazyValue(w); err != nil {
+				break loop
+			}
 			env.push(w)
 			if !env.paths.empty() && env.expdepth == 0 {
 				if !env.pathIntact(v) {
-					err = &invalidPathError{v}
+					err = &invalidPathError{fromLazyValue(v)}
 					break loop
 				}
 				env.paths.push(pathValue{path: p, value: w})
@@ -180,14 +201,20 @@ loop:
 			case [3]any:
 				argcnt := v[1].(int)
 				x, args := env.pop(), env.args[:argcnt]
+				if !inputIgnoredFuncs[v[2].(string)] {
+					x = fromLazyValue(x)
+				}
 				for i := range argcnt {
-					args[i] = env.pop()
+					args[i] = fromLazyValue(env.pop())
 				}
 				w := v[0].(func(any, []any) any)(x, args)
 				if e, ok := w.(error); ok {
 					err = e
 					break loop
 				}
+				if w, err = toLazyValue(w); err != nil {
+					break loop
+				}
 				env.push(w)
 				if !env.paths.empty() && env.expdepth == 0 {
 					switch v[2].(string) {
@@ -258,7 +285,7 @@ loop:
 			}
 			pc, env.scopes.index = env.popscope()
 			if env.scopes.empty() {
-				return env.pop(), true
+				return exportLazyValue(env.pop()), true
 			}
 		case opiter:
 			if err != nil {
@@ -269,6 +296,20 @@ loop:
 			switch v := env.pop().(type) {
 			case []pathValue:
 				xs = v
+			case *lazyValue:
+				if !env.paths.empty() && env.expdepth == 0 && !env.pathIntact(v) {
+					err = &invalidPathIterError{v.get()}
+					break loop
+				}
+				var ok bool
+				if xs, ok = v.entries(); !ok {
+					err = &iteratorError{v.get()}
+					env.push(emptyIter{})
+					break loop
+				}
+				if len(xs) == 0 {
+					break loop
+				}
 			case []any:
 				if !env.paths.empty() && env.expdepth == 0 && !env.pathIntact(v) {
 					err = &invalidPathIterError{v}
@@ -307,6 +348,9 @@ loop:
 						err = e
 						break loop
 					}
+					if w, err = toLazyValue(w); err != nil {
+						break loop
+					}
 					env.push(w)
 					continue
 				}
@@ -339,7 +383,7 @@ loop:
 			}
 			env.pop()
 			if v := env.pop(); !env.pathIntact(v) {
-				err = &invalidPathError{v}
+				err = &invalidPathError{fromLazyValue(v)}
 				break loop
 			}
 			env.push(env.poppaths())
@@ -412,6 +456,9 @@ type pathValue struct {
 
 func (env *env) pathIntact(v any) bool {
 	w := env.paths.top().(pathValue).value
+	if x, ok := w.(*lazyValue); ok && x.decoded && x != v {
+		w = x.value
+	}
 	switch v := v.(type) {
 	case []any, map[string]any:
 		switch w.(type) {
@@ -1,18 +1,29 @@
 package gojq
 
 import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"iter"
 	"maps"
 	"math"
 	"math/big"
+	"math/bits"
+	"math/rand/v2"
 	"net/url"
 	"reflect"
-	"regexp"
 	"slices"
 	"sort"
 	"strconv"
@@ -22,7 +33,13 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/cespare/xxhash/v2"
+	"github.com/clipperhouse/uax29/v2/graphemes"
 	"github.com/itchyny/timefmt-go"
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
 )
 
 //go:generate go run -modfile=go.dev.mod _tools/gen_builtin.go -i builtin.jq -o builtin.go
@@ -89,6 +106,10 @@ func init() {
 		"tojson":         argFunc0(funcToJSON),
 		"fromjson":       argFunc0(funcFromJSON),
 		"format":         argFunc1(funcFormat),
+		"sprintf":        {argcount1 | argcount2, false, funcSprintf},
+		"lpad":           {argcount1 | argcount2, false, funcLpad},
+		"rpad":           {argcount1 | argcount2, false, funcRpad},
+		"tofixed":        argFunc1(funcToFixed),
 		"_tohtml":        argFunc0(funcToHTML),
 		"_touri":         argFunc0(funcToURI),
 		"_tourid":        argFunc0(funcToURId),
@@ -97,6 +118,13 @@ func init() {
 		"_tosh":          argFunc0(funcToSh),
 		"_tobase64":      argFunc0(funcToBase64),
 		"_tobase64d":     argFunc0(funcToBase64d),
+		"_tobase64url":   argFunc0(funcToBase64URL),
+		"_tobase64urld":  argFunc0(funcToBase64URLd),
+		"_tobase32":      argFunc0(funcToBase32),
+		"_tobase32d":     argFunc0(funcToBase32d),
+		"_tohex":         argFunc0(funcToHex),
+		"_tohexd":        argFunc0(funcToHexd),
+		"_tosql":         argFunc0(funcToSQL),
 		"_index":         argFunc2(funcIndex2),
 		"_slice":         argFunc3(funcSlice),
 		"_plus":          argFunc0(funcOpPlus),
@@ -124,6 +152,13 @@ func init() {
 		"_group_by":      argFunc1(funcGroupBy),
 		"unique":         argFunc0(funcUnique),
 		"_unique_by":     argFunc1(funcUniqueBy),
+		"_distinct_by":   argFunc1(funcDistinctBy),
+		"union":          argFunc1(funcUnion),
+		"intersection":   argFunc1(funcIntersection),
+		"difference":     argFunc1(funcDifference),
+		"_left_join":     argFunc3(funcLeftJoin),
+		"_full_join":     argFunc3(funcFullJoin),
+		"_anti_join":     argFunc3(funcAntiJoin),
 		"sin":            mathFunc("sin", math.Sin),
 		"cos":            mathFunc("cos", math.Cos),
 		"tan":            mathFunc("tan", math.Tan),
@@ -136,12 +171,12 @@ func init() {
 		"asinh":          mathFunc("asinh", math.Asinh),
 		"acosh":          mathFunc("acosh", math.Acosh),
 		"atanh":          mathFunc("atanh", math.Atanh),
-		"floor":          mathFunc("floor", math.Floor),
-		"round":          mathFunc("round", math.Round),
-		"nearbyint":      mathFunc("nearbyint", math.RoundToEven),
-		"rint":           mathFunc("rint", math.RoundToEven),
-		"ceil":           mathFunc("ceil", math.Ceil),
-		"trunc":          mathFunc("trunc", math.Trunc),
+		"floor":          roundFunc("floor", math.Floor),
+		"round":          roundFunc("round", math.Round),
+		"nearbyint":      roundFunc("nearbyint", math.RoundToEven),
+		"rint":           roundFunc("rint", math.RoundToEven),
+		"ceil":           roundFunc("ceil", math.Ceil),
+		"trunc":          roundFunc("trunc", math.Trunc),
 		"significand":    mathFunc("significand", funcSignificand),
 		"fabs":           mathFunc("fabs", math.Abs),
 		"sqrt":           mathFunc("sqrt", math.Sqrt),
@@ -182,7 +217,7 @@ func init() {
 		"scalb":          mathFunc2("scalb", funcLdexp),
 		"scalbln":        mathFunc2("scalbln", funcLdexp),
 		"yn":             mathFunc2("yn", funcYn),
-		"pow":            mathFunc2("pow", math.Pow),
+		"pow":            argFunc2(funcPow),
 		"fma":            mathFunc3("fma", math.FMA),
 		"infinite":       argFunc0(funcInfinite),
 		"isfinite":       argFunc0(funcIsfinite),
@@ -190,23 +225,75 @@ func init() {
 		"nan":            argFunc0(funcNan),
 		"isnan":          argFunc0(funcIsnan),
 		"isnormal":       argFunc0(funcIsnormal),
+		"idiv":           argFunc1(funcIdiv),
+		"divmod":         argFunc1(funcDivmod),
+		"isqrt":          argFunc0(funcIsqrt),
+		"bitand":         argFunc1(funcBitand),
+		"bitor":          argFunc1(funcBitor),
+		"bitxor":         argFunc1(funcBitxor),
+		"bitnot":         argFunc0(funcBitnot),
+		"shl":            argFunc1(funcShl),
+		"shr":            argFunc1(funcShr),
+		"popcount":       argFunc0(funcPopcount),
+		"tobinary":       argFunc0(funcToBinary),
+		"tohex":          argFunc0(funcToHexInteger),
 		"setpath":        argFunc2(funcSetpath),
 		"delpaths":       argFunc1(funcDelpaths),
 		"getpath":        argFunc1(funcGetpath),
+		"topointer":      argFunc0(funcTopointer),
+		"frompointer":    argFunc0(funcFrompointer),
+		"getpointer":     argFunc1(funcGetpointer),
+		"setpointer":     argFunc2(funcSetpointer),
+		"delpointer":     argFunc1(funcDelpointer),
+		"jsonpatch":      argFunc1(funcJsonpatch),
+		"jsonpatch_diff": argFunc1(funcJsonpatchDiff),
 		"transpose":      argFunc0(funcTranspose),
 		"bsearch":        argFunc1(funcBsearch),
+		"md5":            hashFunc("md5", md5.New),
+		"sha1":           hashFunc("sha1", sha1.New),
+		"sha256":         hashFunc("sha256", sha256.New),
+		"sha512":         hashFunc("sha512", sha512.New),
+		"crc32":          hashFunc("crc32", func() hash.Hash { return crc32.NewIEEE() }),
+		"xxhash64":       hashFunc("xxhash64", func() hash.Hash { return xxhash.New() }),
+		"hmac_sha256":    {argcount1 | argcount2, false, funcHmacSha256},
 		"gmtime":         argFunc0(funcGmtime),
-		"localtime":      argFunc0(funcLocaltime),
-		"mktime":         argFunc0(funcMktime),
-		"strftime":       argFunc1(funcStrftime),
+		"localtime":      {argcount0 | argcount1, false, funcLocaltime},
+		"mktime":         {argcount0 | argcount1, false, funcMktime},
+		"strftime":       {argcount1 | argcount2, false, funcStrftime},
 		"strflocaltime":  argFunc1(funcStrflocaltime),
-		"strptime":       argFunc1(funcStrptime),
+		"strptime":       {argcount1 | argcount2, false, funcStrptime},
+		"dateadd":        {argcount2 | argcount3, false, funcDateadd},
+		"datesub":        {argcount2 | argcount3, false, funcDatesub},
+		"datediff":       {argcount2 | argcount3, false, funcDatediff},
 		"now":            argFunc0(funcNow),
+		"random":         argFunc0(nil),
+		"random_int":     argFunc2(nil),
+		"shuffle":        argFunc0(nil),
+		"sample":         argFunc1(nil),
+		"uuid4":          argFunc0(nil),
 		"_match":         argFunc3(nil),
 		"_captures":      argFunc0(funcCaptures),
 		"error":          {argcount0 | argcount1, false, funcError},
 		"halt":           argFunc0(funcHalt),
 		"halt_error":     {argcount0 | argcount1, false, funcHaltError},
+
+		// functions for the Unicode text
+		"downcase":        argFunc0(funcDowncase),
+		"upcase":          argFunc0(funcUpcase),
+		"casefold":        argFunc0(funcCasefold),
+		"normalize":       argFunc1(funcNormalize),
+		"graphemes":       argFunc0(funcGraphemes),
+		"grapheme_length": argFunc0(funcGraphemeLength),
+		"display_width":   argFunc0(funcDisplayWidth),
+
+		// functions for the ISO 8601 durations
+		"fromdurationiso8601": argFunc0(funcFromdurationiso8601),
+		"todurationiso8601":   argFunc0(funcTodurationiso8601),
+
+		// functions for the metadata of the input iterator
+		"input_filename":    argFunc0(nil),
+		"input_line_number": argFunc0(nil),
+		"input_offset":      argFunc0(nil),
 	}
 }
 
@@ -252,6 +339,23 @@ func mathFunc(name string, f func(float64) float64) function {
 	})
 }
 
+// roundFunc returns the integers as they are, to keep the precision.
+func roundFunc(name string, f func(float64) float64) function {
+	return argFunc0(func(v any) any {
+		if n, ok := v.(json.Number); ok {
+			v = parseNumber(n)
+		}
+		switch v := v.(type) {
+		case int, *big.Int:
+			return v
+		case float64:
+			return f(v)
+		default:
+			return &func0TypeError{name, v}
+		}
+	})
+}
+
 func mathFunc2(name string, f func(_, _ float64) float64) function {
 	return argFunc2(func(_, x, y any) any {
 		l, ok := toFloat(x)
@@ -831,6 +935,88 @@ func funcASCIIUpcase(v any) any {
 	}, s)
 }
 
+func funcDowncase(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return &func0TypeError{"downcase", v}
+	}
+	return cases.Lower(language.Und).String(s)
+}
+
+func funcUpcase(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return &func0TypeError{"upcase", v}
+	}
+	return cases.Upper(language.Und).String(s)
+}
+
+func funcCasefold(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return &func0TypeError{"casefold", v}
+	}
+	return cases.Fold().String(s)
+}
+
+func funcNormalize(v, x any) any {
+	s, ok := v.(string)
+	if !ok {
+		return &func1TypeError{"normalize", v, x}
+	}
+	var form norm.Form
+	switch x {
+	case "NFC":
+		form = norm.NFC
+	case "NFD":
+		form = norm.NFD
+	case "NFKC":
+		form = norm.NFKC
+	case "NFKD":
+		form = norm.NFKD
+	default:
+		return &func1WrapError{"normalize", v, x,
+			errors.New(`normalization form should be "NFC", "NFD", "NFKC", or "NFKD"`)}
+	}
+	return form.String(s)
+}
+
+func funcGraphemes(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return &func0TypeError{"graphemes", v}
+	}
+	xs := []any{}
+	for g := graphemes.FromString(s); g.Next(); {
+		xs = append(xs, g.Value())
+	}
+	return xs
+}
+
+func funcGraphemeLength(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return &func0TypeError{"grapheme_length", v}
+	}
+	var n int
+	for g := graphemes.FromString(s); g.Next(); {
+		n++
+	}
+	return n
+}
+
+// displayWidthCondition treats the East Asian ambiguous characters as narrow,
+// regardless of the locale environment variables.
+var displayWidthCondition = &runewidth.Condition{StrictEmojiNeutral: true}
+
+func funcDisplayWidth(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return &func0TypeError{"display_width", v}
+	}
+	return displayWidthCondition.StringWidth(s)
+}
+
 func funcToJSON(v any) any {
 	return jsonMarshal(v)
 }
@@ -865,6 +1051,199 @@ func funcFormat(v, x any) any {
 	return internalFuncs[f.Name].callback(v, nil)
 }
 
+func funcSprintf(v any, args []any) any {
+	format, ok := args[0].(string)
+	if !ok {
+		return funcTypeError("sprintf", v, args)
+	}
+	xs := v
+	if len(args) > 1 {
+		xs = args[1]
+	}
+	vs, ok := xs.([]any)
+	if !ok {
+		vs = []any{xs}
+	}
+	s, err := sprintf(format, vs)
+	if err != nil {
+		return funcWrapError("sprintf", v, args, err)
+	}
+	return s
+}
+
+// sprintf formats the values like printf in C. The verbs are %s, %d, %i, %x,
+// %X, %o, %b, %c, %e, %E, %f, %F, %g, and %G, with flags, width and precision.
+func sprintf(format string, vs []any) (string, error) {
+	var sb strings.Builder
+	var i int
+	for {
+		j := strings.IndexByte(format, '%')
+		if j < 0 {
+			sb.WriteString(format)
+			break
+		}
+		sb.WriteString(format[:j])
+		format = format[j:]
+		k := 1
+		for k < len(format) && strings.IndexByte("-+ 0#", format[k]) >= 0 {
+			k++
+		}
+		l := k
+		for k < len(format) && isNumber(format[k]) {
+			k++
+		}
+		width, prec := format[l:k], ""
+		if k < len(format) && format[k] == '.' {
+			for k, l = k+1, k+1; k < len(format) && isNumber(format[k]); k++ {
+			}
+			prec = format[l:k]
+		}
+		if k == len(format) {
+			return "", fmt.Errorf("incomplete format: %q", format)
+		}
+		spec, verb := format[:k+1], format[k]
+		// the fmt package does not accept the width or precision above 1e6
+		for _, n := range []string{width, prec} {
+			if n == "" {
+				continue
+			}
+			if n, err := strconv.Atoi(n); err != nil || n > 1e6 {
+				return "", fmt.Errorf("width or precision too large: %q", spec)
+			}
+		}
+		format = format[k+1:]
+		if verb == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+		if i == len(vs) {
+			return "", errors.New("not enough arguments for format")
+		}
+		if err := sprintfValue(&sb, spec, verb, vs[i]); err != nil {
+			return "", err
+		}
+		i++
+	}
+	if i < len(vs) {
+		return "", errors.New("too many arguments for format")
+	}
+	return sb.String(), nil
+}
+
+func sprintfValue(sb *strings.Builder, spec string, verb byte, v any) error {
+	if n, ok := v.(json.Number); ok {
+		v = parseNumber(n)
+	}
+	switch verb {
+	case 's', 'v':
+		fmt.Fprintf(sb, spec[:len(spec)-1]+"s", funcToString(v))
+	case 'd', 'i', 'x', 'X', 'o', 'b':
+		if x, ok := v.(float64); ok {
+			v = math.Trunc(x)
+		}
+		x, ok := toInteger(v)
+		if !ok {
+			return &sprintfTypeError{spec, v}
+		}
+		if verb == 'i' {
+			spec = spec[:len(spec)-1] + "d"
+		}
+		fmt.Fprintf(sb, spec, x)
+	case 'c':
+		x, ok := toInt(v)
+		if !ok {
+			return &sprintfTypeError{spec, v}
+		}
+		fmt.Fprintf(sb, spec, rune(x))
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		switch x := v.(type) {
+		case int:
+			if -1<<53 <= x && x <= 1<<53 {
+				fmt.Fprintf(sb, spec, float64(x))
+			} else {
+				fmt.Fprintf(sb, spec, new(big.Float).SetInt64(int64(x)))
+			}
+		case float64:
+			fmt.Fprintf(sb, spec, x)
+		case *big.Int:
+			fmt.Fprintf(sb, spec, new(big.Float).SetPrec(uint(max(x.BitLen(), 64))).SetInt(x))
+		default:
+			return &sprintfTypeError{spec, v}
+		}
+	default:
+		return fmt.Errorf("unknown format verb: %q", spec)
+	}
+	return nil
+}
+
+func funcLpad(v any, args []any) any {
+	return pad("lpad", v, args, true)
+}
+
+func funcRpad(v any, args []any) any {
+	return pad("rpad", v, args, false)
+}
+
+func pad(name string, v any, args []any, left bool) any {
+	s := funcToString(v).(string)
+	width, ok := toInt(args[0])
+	if !ok {
+		return funcTypeError(name, v, args)
+	}
+	padding := " "
+	if len(args) > 1 {
+		if padding, ok = args[1].(string); !ok {
+			return funcTypeError(name, v, args)
+		}
+		if utf8.RuneCountInString(padding) != 1 {
+			return funcWrapError(name, v, args,
+				errors.New("padding should be a single character"))
+		}
+	}
+	n := width - utf8.RuneCountInString(s)
+	if n <= 0 {
+		return s
+	}
+	if n >= math.MaxInt32/len(padding) {
+		return funcWrapError(name, v, args, errors.New("padding result too large"))
+	}
+	if left {
+		return strings.Repeat(padding, n) + s
+	}
+	return s + strings.Repeat(padding, n)
+}
+
+func funcToFixed(v, x any) any {
+	if n, ok := v.(json.Number); ok {
+		v = parseNumber(n)
+	}
+	prec, ok := toInt(x)
+	if !ok {
+		return &func1TypeError{"tofixed", v, x}
+	}
+	if prec < 0 || prec > 1000 {
+		return &func1WrapError{"tofixed", v, x,
+			errors.New("precision should be between 0 and 1000")}
+	}
+	switch v := v.(type) {
+	case int:
+		return fixedInteger(strconv.Itoa(v), prec)
+	case float64:
+		return strconv.FormatFloat(v, 'f', prec, 64)
+	case *big.Int:
+		return fixedInteger(v.String(), prec)
+	default:
+		return &func1TypeError{"tofixed", v, x}
+	}
+}
+
+func fixedInteger(s string, prec int) string {
+	if prec == 0 {
+		return s
+	}
+	return s + "." + strings.Repeat("0", prec)
+}
+
 var htmlEscaper = strings.NewReplacer(
 	`<`, "&lt;",
 	`>`, "&gt;",
@@ -954,7 +1333,7 @@ func formatJoin(typ string, v any, sep string, escape func(string) string) any {
 		case string:
 			ss[i] = escape(v)
 		default:
-			if s := jsonMarshal(v); s != "null" || typ == "sh" {
+			if s := jsonMarshal(v); s != "null" || typ == "sh" || typ == "sql" {
 				ss[i] = s
 			}
 		}
@@ -962,6 +1341,19 @@ func formatJoin(typ string, v any, sep string, escape func(string) string) any {
 	return strings.Join(ss, sep)
 }
 
+var sqlEscaper = strings.NewReplacer(
+	"'", "''",
+)
+
+func funcToSQL(v any) any {
+	if _, ok := v.([]any); !ok {
+		v = []any{v}
+	}
+	return formatJoin("sql", v, ",", func(s string) string {
+		return "'" + sqlEscaper.Replace(s) + "'"
+	})
+}
+
 func funcToBase64(v any) any {
 	switch x := funcToString(v).(type) {
 	case string:
@@ -987,6 +1379,78 @@ func funcToBase64d(v any) any {
 	}
 }
 
+func funcToBase64URL(v any) any {
+	switch x := funcToString(v).(type) {
+	case string:
+		return base64.RawURLEncoding.EncodeToString([]byte(x))
+	default:
+		return x
+	}
+}
+
+func funcToBase64URLd(v any) any {
+	switch x := funcToString(v).(type) {
+	case string:
+		if i := strings.IndexRune(x, base64.StdPadding); i >= 0 {
+			x = x[:i]
+		}
+		y, err := base64.RawURLEncoding.DecodeString(x)
+		if err != nil {
+			return &func0WrapError{"@base64urld", v, err}
+		}
+		return string(y)
+	default:
+		return x
+	}
+}
+
+func funcToBase32(v any) any {
+	switch x := funcToString(v).(type) {
+	case string:
+		return base32.StdEncoding.EncodeToString([]byte(x))
+	default:
+		return x
+	}
+}
+
+func funcToBase32d(v any) any {
+	switch x := funcToString(v).(type) {
+	case string:
+		if i := strings.IndexRune(x, base32.StdPadding); i >= 0 {
+			x = x[:i]
+		}
+		y, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(x)
+		if err != nil {
+			return &func0WrapError{"@base32d", v, err}
+		}
+		return string(y)
+	default:
+		return x
+	}
+}
+
+func funcToHex(v any) any {
+	switch x := funcToString(v).(type) {
+	case string:
+		return hex.EncodeToString([]byte(x))
+	default:
+		return x
+	}
+}
+
+func funcToHexd(v any) any {
+	switch x := funcToString(v).(type) {
+	case string:
+		y, err := hex.DecodeString(x)
+		if err != nil {
+			return &func0WrapError{"@hexd", v, err}
+		}
+		return string(y)
+	default:
+		return x
+	}
+}
+
 func funcIndex2(_, v, x any) any {
 	switch x := x.(type) {
 	case string:
@@ -1357,46 +1821,275 @@ func uniqueBy(name string, v, x any) any {
 	return rs
 }
 
-func funcSignificand(v float64) float64 {
-	frac, _ := math.Frexp(v)
-	return frac * 2
+func funcDistinctBy(v, x any) any {
+	vs, ok := v.([]any)
+	if !ok {
+		return &func1TypeError{"distinct_by", v, x}
+	}
+	xs, ok := x.([]any)
+	if !ok {
+		return &func1TypeError{"distinct_by", v, x}
+	}
+	if len(vs) != len(xs) {
+		return &func1WrapError{"distinct_by", v, x, &lengthMismatchError{}}
+	}
+	rs, s := []any{}, valueSet{}
+	for i, v := range vs {
+		if s.add(xs[i]) {
+			rs = append(rs, v)
+		}
+	}
+	return rs
 }
 
-func funcExp10(v float64) float64 {
-	return math.Pow(10, v)
+func funcUnion(v, x any) any {
+	return setOperation("union", v, x, func(vs, xs []any) []any {
+		rs, s := []any{}, valueSet{}
+		for _, vs := range [][]any{vs, xs} {
+			for _, v := range vs {
+				if s.add(v) {
+					rs = append(rs, v)
+				}
+			}
+		}
+		return rs
+	})
 }
 
-func funcFrexp(v any) any {
-	x, ok := toFloat(v)
+func funcIntersection(v, x any) any {
+	return setOperation("intersection", v, x, func(vs, xs []any) []any {
+		return filterSet(vs, xs, true)
+	})
+}
+
+func funcDifference(v, x any) any {
+	return setOperation("difference", v, x, func(vs, xs []any) []any {
+		return filterSet(vs, xs, false)
+	})
+}
+
+func setOperation(name string, v, x any, f func(_, _ []any) []any) any {
+	vs, ok := v.([]any)
 	if !ok {
-		return &func0TypeError{"frexp", v}
+		return &func1TypeError{name, v, x}
 	}
-	f, e := math.Frexp(x)
-	return []any{f, e}
+	xs, ok := x.([]any)
+	if !ok {
+		return &func1TypeError{name, v, x}
+	}
+	return f(vs, xs)
 }
 
-func funcModf(v any) any {
-	x, ok := toFloat(v)
-	if !ok {
-		return &func0TypeError{"modf", v}
+// Returns the distinct values of vs which are (or are not) contained in xs.
+func filterSet(vs, xs []any, contained bool) []any {
+	t := valueSet{}
+	for _, x := range xs {
+		t.add(x)
 	}
-	if math.IsInf(x, 0) {
-		return []any{math.Copysign(0, x), x}
+	rs, s := []any{}, valueSet{}
+	for _, v := range vs {
+		if t.has(v) == contained && s.add(v) {
+			rs = append(rs, v)
+		}
 	}
-	i, f := math.Modf(x)
-	return []any{f, i}
+	return rs
 }
 
-func funcLgamma(v float64) float64 {
-	v, _ = math.Lgamma(v)
-	return v
+func funcLeftJoin(v, r, xs, ys any) any {
+	return join("left_join", v, r, xs, ys, true, false)
 }
 
-func funcDrem(l, r float64) float64 {
-	x := math.Remainder(l, r)
-	if x == 0.0 {
-		return math.Copysign(x, l)
-	}
+func funcFullJoin(v, r, xs, ys any) any {
+	return join("full_join", v, r, xs, ys, true, true)
+}
+
+func funcAntiJoin(v, r, xs, ys any) any {
+	return join("anti_join", v, r, xs, ys, false, false)
+}
+
+// Joins the arrays v and r by the keys xs and ys. The pairs of the matching
+// values are emitted in the order of v and then r, and the unmatched values
+// of v are paired with null (or emitted as they are unless pairs). The full
+// join also emits the unmatched values of r paired with null at the end. Like
+// SQL, the keys containing null (missing keys) do not match any other keys.
+func join(name string, v, r, xs, ys any, pairs, full bool) any {
+	vs, ok := v.([]any)
+	if !ok {
+		return &func3TypeError{name, v, r, xs, ys}
+	}
+	ws, ok := r.([]any)
+	if !ok {
+		return &func3TypeError{name, v, r, xs, ys}
+	}
+	ks, ls := xs.([]any), ys.([]any)
+	if len(vs) != len(ks) || len(ws) != len(ls) {
+		return &func3WrapError{name, v, r, xs, ys, &lengthMismatchError{}}
+	}
+	index := make(map[string][]int, len(ls))
+	for j, l := range ls {
+		// the keys of v containing null cannot match the keys in the index
+		if !hasNullKey(l) {
+			h := hashKey(l)
+			index[h] = append(index[h], j)
+		}
+	}
+	var matched []bool
+	if full {
+		matched = make([]bool, len(ws))
+	}
+	rs := []any{}
+	for i, k := range ks {
+		var found bool
+		for _, j := range index[hashKey(k)] {
+			if Compare(k, ls[j]) == 0 {
+				if found = true; !pairs {
+					break
+				}
+				rs = append(rs, []any{vs[i], ws[j]})
+				if full {
+					matched[j] = true
+				}
+			}
+		}
+		if !found {
+			if pairs {
+				rs = append(rs, []any{vs[i], nil})
+			} else {
+				rs = append(rs, vs[i])
+			}
+		}
+	}
+	for j, ok := range matched {
+		if !ok {
+			rs = append(rs, []any{nil, ws[j]})
+		}
+	}
+	return rs
+}
+
+func hasNullKey(k any) bool {
+	ks := k.([]any)
+	return len(ks) == 0 || slices.Contains(ks, nil)
+}
+
+// A valueSet is a set of values under the equality of Compare.
+type valueSet map[string][]any
+
+func (s valueSet) has(v any) bool {
+	for _, w := range s[hashKey(v)] {
+		if Compare(v, w) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds the value to the set, and reports whether the value is newly added.
+func (s valueSet) add(v any) bool {
+	h := hashKey(v)
+	for _, w := range s[h] {
+		if Compare(v, w) == 0 {
+			return false
+		}
+	}
+	s[h] = append(s[h], v)
+	return true
+}
+
+// Returns the hash key of the value, which is the same for the equal values
+// under the equality of Compare. Since the numbers of different types are
+// compared as float64 values, the numbers are hashed as float64 values, and
+// the unequal values like 1<<53 and 1<<53+1 may have the same key.
+func hashKey(v any) string {
+	var sb strings.Builder
+	writeHashKey(&sb, v)
+	return sb.String()
+}
+
+func writeHashKey(sb *strings.Builder, v any) {
+	switch v := decodeRawMessage(v).(type) {
+	case nil:
+		sb.WriteByte('n')
+	case bool:
+		if v {
+			sb.WriteByte('t')
+		} else {
+			sb.WriteByte('f')
+		}
+	case int, float64, *big.Int, json.Number:
+		if n, ok := v.(json.Number); ok {
+			v = parseNumber(n)
+		}
+		f, _ := toFloat(v)
+		if f == 0 {
+			f = 0 // normalize negative zero
+		}
+		sb.WriteByte('d')
+		sb.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		sb.WriteByte(';')
+	case string:
+		sb.WriteByte('s')
+		sb.WriteString(strconv.Itoa(len(v)))
+		sb.WriteByte(':')
+		sb.WriteString(v)
+	case []any:
+		sb.WriteByte('[')
+		for _, x := range v {
+			writeHashKey(sb, x)
+		}
+		sb.WriteByte(']')
+	case map[string]any:
+		sb.WriteByte('{')
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			writeHashKey(sb, k)
+			writeHashKey(sb, v[k])
+		}
+		sb.WriteByte('}')
+	default:
+		sb.WriteByte('?')
+	}
+}
+
+func funcSignificand(v float64) float64 {
+	frac, _ := math.Frexp(v)
+	return frac * 2
+}
+
+func funcExp10(v float64) float64 {
+	return math.Pow(10, v)
+}
+
+func funcFrexp(v any) any {
+	x, ok := toFloat(v)
+	if !ok {
+		return &func0TypeError{"frexp", v}
+	}
+	f, e := math.Frexp(x)
+	return []any{f, e}
+}
+
+func funcModf(v any) any {
+	x, ok := toFloat(v)
+	if !ok {
+		return &func0TypeError{"modf", v}
+	}
+	if math.IsInf(x, 0) {
+		return []any{math.Copysign(0, x), x}
+	}
+	i, f := math.Modf(x)
+	return []any{f, i}
+}
+
+func funcLgamma(v float64) float64 {
+	v, _ = math.Lgamma(v)
+	return v
+}
+
+func funcDrem(l, r float64) float64 {
+	x := math.Remainder(l, r)
+	if x == 0.0 {
+		return math.Copysign(x, l)
+	}
 	return x
 }
 
@@ -1432,6 +2125,118 @@ func funcYn(l, r float64) float64 {
 	return math.Yn(int(l), r)
 }
 
+func funcPow(_, x, y any) any {
+	if v, ok := x.(json.Number); ok {
+		x = parseNumber(v)
+	}
+	if v, ok := y.(json.Number); ok {
+		y = parseNumber(v)
+	}
+	switch l := x.(type) {
+	case int, *big.Int:
+		switch r := y.(type) {
+		case int, *big.Int:
+			if v := powInteger(toBigInt(l), toBigInt(r)); v != nil {
+				return v
+			}
+		}
+	}
+	l, ok := toFloat(x)
+	if !ok {
+		return &func0TypeError{"pow", x}
+	}
+	r, ok := toFloat(y)
+	if !ok {
+		return &func0TypeError{"pow", y}
+	}
+	return math.Pow(l, r)
+}
+
+// powInteger calculates the power of the integers, or returns nil when the
+// exponent is negative or the result is too large.
+func powInteger(x, y *big.Int) any {
+	switch y.Sign() {
+	case -1:
+		return nil
+	case 0:
+		return 1
+	}
+	if x.CmpAbs(big.NewInt(1)) <= 0 {
+		if x.Sign() < 0 && y.Bit(0) == 0 {
+			return 1
+		}
+		return normalizeBigInt(x)
+	}
+	if !y.IsInt64() || int64(x.BitLen())*y.Int64() > 1<<24 {
+		return nil
+	}
+	return normalizeBigInt(new(big.Int).Exp(x, y, nil))
+}
+
+func funcIdiv(v, x any) any {
+	q, _, err := divideInteger("idiv", v, x)
+	if err != nil {
+		return err
+	}
+	return q
+}
+
+func funcDivmod(v, x any) any {
+	q, r, err := divideInteger("divmod", v, x)
+	if err != nil {
+		return err
+	}
+	return []any{q, r}
+}
+
+// divideInteger calculates the quotient truncated toward zero and the
+// remainder, which is consistent with the modulo operator.
+func divideInteger(name string, v, x any) (any, any, error) {
+	l, ok := toInteger(v)
+	if !ok {
+		return nil, nil, &func1WrapError{name, v, x, &expectedIntegerError{v}}
+	}
+	r, ok := toInteger(x)
+	if !ok {
+		return nil, nil, &func1WrapError{name, v, x, &expectedIntegerError{x}}
+	}
+	if l, ok := l.(int); ok {
+		if r, ok := r.(int); ok {
+			switch r {
+			case 0:
+				return nil, nil, &zeroDivisionError{v, x}
+			case -1:
+				return negate(l), 0, nil
+			default:
+				return l / r, l % r, nil
+			}
+		}
+	}
+	y := toBigInt(r)
+	if y.Sign() == 0 {
+		return nil, nil, &zeroDivisionError{v, x}
+	}
+	q, m := new(big.Int).QuoRem(toBigInt(l), y, new(big.Int))
+	return normalizeBigInt(q), normalizeBigInt(m), nil
+}
+
+func funcIsqrt(v any) any {
+	switch x, _ := toInteger(v); x := x.(type) {
+	case int:
+		if x < 0 {
+			return &func0WrapError{"isqrt", v, errors.New("integer should not be negative")}
+		}
+		return normalizeBigInt(new(big.Int).Sqrt(big.NewInt(int64(x))))
+	case *big.Int:
+		if x.Sign() < 0 {
+			return &func0WrapError{"isqrt", v, errors.New("integer should not be negative")}
+		}
+		return normalizeBigInt(new(big.Int).Sqrt(x))
+	default:
+		return &func0WrapError{"isqrt", v, &expectedIntegerError{v}}
+	}
+}
+
 func funcInfinite(any) any {
 	return math.Inf(1)
 }
@@ -1472,8 +2277,10 @@ func funcIsnormal(v any) any {
 // An `allocator` creates new maps and slices, stores the allocated addresses.
 // This allocator is used to reduce allocations on assignment operator (`=`),
 // update-assignment operator (`|=`), and the `map_values`, `del`, `delpaths`
-// functions.
-type allocator map[uintptr]struct{}
+// functions, and the accumulators of `reduce` and `foreach` syntax. It also
+// stores the string builders keyed by the addresses of the built strings, to
+// concatenate strings without copying (the value is nil for maps and slices).
+type allocator map[uintptr]*strings.Builder
 
 func funcAllocator(any, []any) any {
 	return allocator{}
@@ -1487,7 +2294,7 @@ func (a allocator) allocated(v any) bool {
 func (a allocator) makeObject(l int) map[string]any {
 	v := make(map[string]any, l)
 	if a != nil {
-		a[reflect.ValueOf(v).Pointer()] = struct{}{}
+		a[reflect.ValueOf(v).Pointer()] = nil
 	}
 	return v
 }
@@ -1495,11 +2302,193 @@ func (a allocator) makeObject(l int) map[string]any {
 func (a allocator) makeArray(l, c int) []any {
 	v := make([]any, l, max(l, c))
 	if a != nil {
-		a[reflect.ValueOf(v).Pointer()] = struct{}{}
+		a[reflect.ValueOf(v).Pointer()] = nil
 	}
 	return v
 }
 
+// Releases the allocated maps and slices in v, which is replaced with n. The
+// released values are no longer updated in place, since they may be referenced
+// from other values. Also, the addresses of unreachable values may be reused.
+func (a allocator) release(v, n any) {
+	if len(a) == 0 {
+		return
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		if n, ok := n.(map[string]any); ok &&
+			reflect.ValueOf(n).Pointer() == reflect.ValueOf(v).Pointer() {
+			return
+		}
+	case []any:
+		if n, ok := n.([]any); ok &&
+			reflect.ValueOf(n).Pointer() == reflect.ValueOf(v).Pointer() {
+			return
+		}
+	default:
+		return
+	}
+	a.disown(v)
+}
+
+func (a allocator) disown(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		if p := reflect.ValueOf(v).Pointer(); a.allocated(v) {
+			delete(a, p)
+			for _, x := range v {
+				a.disown(x)
+			}
+		}
+	case []any:
+		if p := reflect.ValueOf(v).Pointer(); a.allocated(v) {
+			delete(a, p)
+			for _, x := range v {
+				a.disown(x)
+			}
+		}
+	}
+}
+
+func funcBitand(v, x any) any {
+	return bitwiseOp("bitand", v, x,
+		func(l, r int) int { return l & r }, (*big.Int).And)
+}
+
+func funcBitor(v, x any) any {
+	return bitwiseOp("bitor", v, x,
+		func(l, r int) int { return l | r }, (*big.Int).Or)
+}
+
+func funcBitxor(v, x any) any {
+	return bitwiseOp("bitxor", v, x,
+		func(l, r int) int { return l ^ r }, (*big.Int).Xor)
+}
+
+func bitwiseOp(name string, v, x any,
+	callbackInts func(_, _ int) int,
+	callbackBigInts func(_, _, _ *big.Int) *big.Int) any {
+	l, ok := toInteger(v)
+	if !ok {
+		return &func1WrapError{name, v, x, &expectedIntegerError{v}}
+	}
+	r, ok := toInteger(x)
+	if !ok {
+		return &func1WrapError{name, v, x, &expectedIntegerError{x}}
+	}
+	if l, ok := l.(int); ok {
+		if r, ok := r.(int); ok {
+			return callbackInts(l, r)
+		}
+	}
+	return normalizeBigInt(callbackBigInts(new(big.Int), toBigInt(l), toBigInt(r)))
+}
+
+func funcBitnot(v any) any {
+	switch x, _ := toInteger(v); x := x.(type) {
+	case int:
+		return ^x
+	case *big.Int:
+		return normalizeBigInt(new(big.Int).Not(x))
+	default:
+		return &func0WrapError{"bitnot", v, &expectedIntegerError{v}}
+	}
+}
+
+func funcShl(v, x any) any {
+	l, ok := toInteger(v)
+	if !ok {
+		return &func1WrapError{"shl", v, x, &expectedIntegerError{v}}
+	}
+	n, err := toShiftCount(x)
+	if err != nil {
+		return &func1WrapError{"shl", v, x, err}
+	}
+	if l, ok := l.(int); ok && n < 64 && l<<n>>n == l {
+		return l << n
+	}
+	y := toBigInt(l)
+	if y.Sign() == 0 {
+		return 0
+	}
+	if y.BitLen()+n >= math.MaxInt32 {
+		return &func1WrapError{"shl", v, x, errors.New("shift result too large")}
+	}
+	return new(big.Int).Lsh(y, uint(n))
+}
+
+func funcShr(v, x any) any {
+	l, ok := toInteger(v)
+	if !ok {
+		return &func1WrapError{"shr", v, x, &expectedIntegerError{v}}
+	}
+	n, err := toShiftCount(x)
+	if err != nil {
+		return &func1WrapError{"shr", v, x, err}
+	}
+	if l, ok := l.(int); ok {
+		return l >> n
+	}
+	return normalizeBigInt(new(big.Int).Rsh(l.(*big.Int), uint(n)))
+}
+
+func toShiftCount(x any) (int, error) {
+	switch n, _ := toInteger(x); n := n.(type) {
+	case int:
+		if n < 0 {
+			return 0, errors.New("shift count should not be negative")
+		}
+		return n, nil
+	case *big.Int:
+		if n.Sign() < 0 {
+			return 0, errors.New("shift count should not be negative")
+		}
+		return math.MaxInt32, nil
+	default:
+		return 0, &expectedIntegerError{x}
+	}
+}
+
+func funcPopcount(v any) any {
+	switch x, _ := toInteger(v); x := x.(type) {
+	case int:
+		if x < 0 {
+			return &func0WrapError{"popcount", v, errors.New("integer should not be negative")}
+		}
+		return bits.OnesCount(uint(x))
+	case *big.Int:
+		if x.Sign() < 0 {
+			return &func0WrapError{"popcount", v, errors.New("integer should not be negative")}
+		}
+		var n int
+		for _, w := range x.Bits() {
+			n += bits.OnesCount(uint(w))
+		}
+		return n
+	default:
+		return &func0WrapError{"popcount", v, &expectedIntegerError{v}}
+	}
+}
+
+func funcToBinary(v any) any {
+	return formatInteger("tobinary", v, 2)
+}
+
+func funcToHexInteger(v any) any {
+	return formatInteger("tohex", v, 16)
+}
+
+func formatInteger(name string, v any, base int) any {
+	switch x, _ := toInteger(v); x := x.(type) {
+	case int:
+		return strconv.FormatInt(int64(x), base)
+	case *big.Int:
+		return x.Text(base)
+	default:
+		return &func0WrapError{name, v, &expectedIntegerError{v}}
+	}
+}
+
 func funcSetpath(v, p, n any) any {
 	// There is no need to use an allocator on a single update.
 	return setpath(v, p, n, nil)
@@ -1560,6 +2549,7 @@ func delpaths(v, p any, a allocator) any {
 
 func update(v any, path []any, n any, a allocator) (any, error) {
 	if len(path) == 0 {
+		a.release(v, n)
 		return n, nil
 	}
 	switch p := path[0].(type) {
@@ -1666,6 +2656,7 @@ func updateArrayIndex(v []any, i int, path []any, n any, a allocator) (any, erro
 			v[i] = u
 			return v, nil
 		}
+		delete(a, reflect.ValueOf(v).Pointer())
 		c *= 2
 	}
 	if i >= l {
@@ -1777,40 +2768,452 @@ func funcGetpath(v, p any) any {
 	if !ok {
 		return &func1TypeError{"getpath", v, p}
 	}
+	return getpath("getpath", v, p, path)
+}
+
+func getpath(name string, v, p any, path []any) any {
 	u := v
 	for _, x := range path {
 		switch v.(type) {
 		case nil, []any, map[string]any:
 			v = funcIndex2(nil, v, x)
 			if err, ok := v.(error); ok {
-				return &func1WrapError{"getpath", u, p, err}
+				return &func1WrapError{name, u, p, err}
 			}
 		default:
-			return &func1TypeError{"getpath", u, p}
+			return &func1TypeError{name, u, p}
 		}
 	}
 	return v
 }
 
-func funcTranspose(v any) any {
-	vss, ok := v.([]any)
+// JSON Pointer (RFC 6901)
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+func funcTopointer(v any) any {
+	path, ok := v.([]any)
 	if !ok {
-		return &func0TypeError{"transpose", v}
-	}
-	if len(vss) == 0 {
-		return []any{}
+		return &func0TypeError{"topointer", v}
 	}
-	var l int
-	for _, vs := range vss {
-		vs, ok := vs.([]any)
-		if !ok {
-			return &func0TypeError{"transpose", v}
-		}
-		if k := len(vs); l < k {
-			l = k
+	var sb strings.Builder
+	for _, x := range path {
+		sb.WriteByte('/')
+		switch x := x.(type) {
+		case string:
+			pointerEscaper.WriteString(&sb, x)
+		default:
+			i, ok := toInteger(x)
+			if !ok || toBigInt(i).Sign() < 0 {
+				return &func0TypeError{"topointer", v}
+			}
+			sb.WriteString(Preview(i))
 		}
 	}
-	wss := make([][]any, l)
+	return sb.String()
+}
+
+func funcFrompointer(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return &func0TypeError{"frompointer", v}
+	}
+	tokens, err := parsePointer(s)
+	if err != nil {
+		return &func0WrapError{"frompointer", v, err}
+	}
+	path := make([]any, len(tokens))
+	for i, token := range tokens {
+		if j, ok := pointerIndex(token); ok {
+			path[i] = j
+		} else {
+			path[i] = token
+		}
+	}
+	return path
+}
+
+func funcGetpointer(v, p any) any {
+	s, ok := p.(string)
+	if !ok {
+		return &func1TypeError{"getpointer", v, p}
+	}
+	path, err := pointerToPath(v, s)
+	if err != nil {
+		return &func1WrapError{"getpointer", v, p, err}
+	}
+	return getpath("getpointer", v, p, path)
+}
+
+func funcSetpointer(v, p, n any) any {
+	s, ok := p.(string)
+	if !ok {
+		return &func2TypeError{"setpointer", v, p, n}
+	}
+	path, err := pointerToPath(v, s)
+	if err != nil {
+		return &func2WrapError{"setpointer", v, p, n, err}
+	}
+	u, err := update(v, path, n, nil)
+	if err != nil {
+		return &func2WrapError{"setpointer", v, p, n, err}
+	}
+	return u
+}
+
+func funcDelpointer(v, p any) any {
+	s, ok := p.(string)
+	if !ok {
+		return &func1TypeError{"delpointer", v, p}
+	}
+	path, err := pointerToPath(v, s)
+	if err != nil {
+		return &func1WrapError{"delpointer", v, p, err}
+	}
+	u, err := update(v, path, struct{}{}, allocator{})
+	if err != nil {
+		return &func1WrapError{"delpointer", v, p, err}
+	}
+	return deleteEmpty(u)
+}
+
+// JSON Patch (RFC 6902)
+func funcJsonpatch(v, ops any) any {
+	xs, ok := ops.([]any)
+	if !ok {
+		return &func1TypeError{"jsonpatch", v, ops}
+	}
+	// The values are immutable, so the patch is applied atomically.
+	u := v
+	for i, x := range xs {
+		var err error
+		if u, err = applyPatch(u, i, x); err != nil {
+			if _, ok := err.(*exitCodeError); ok {
+				return err
+			}
+			return &func1WrapError{"jsonpatch", v, ops, err}
+		}
+	}
+	return u
+}
+
+func applyPatch(v any, i int, x any) (any, error) {
+	op, ok := x.(map[string]any)
+	if !ok {
+		return nil, &jsonpatchError{i, "invalid operation", x}
+	}
+	path, w, found, err := patchLookup(v, i, op, "path")
+	if err != nil {
+		return nil, err
+	}
+	value, hasValue := op["value"]
+	switch op["op"] {
+	case "add":
+		if hasValue {
+			return patchAdd(v, i, op["path"], path, value)
+		}
+	case "remove":
+		if !found {
+			return nil, &jsonpatchError{i, "path not found", op["path"]}
+		}
+		return patchRemove(v, path)
+	case "replace":
+		if !found {
+			return nil, &jsonpatchError{i, "path not found", op["path"]}
+		}
+		if hasValue {
+			return update(v, path, value, nil)
+		}
+	case "move", "copy":
+		from, w, found, err := patchLookup(v, i, op, "from")
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, &jsonpatchError{i, "path not found", op["from"]}
+		}
+		if op["op"] == "move" {
+			if len(from) <= len(path) && Compare(from, path[:len(from)]) == 0 {
+				if len(from) == len(path) {
+					return v, nil
+				}
+				return nil, &jsonpatchError{i, "cannot move to its own child", op["path"]}
+			}
+			if v, err = patchRemove(v, from); err != nil {
+				return nil, err
+			}
+			// Resolves the path again since removing may shift the array indices.
+			if path, _, _, err = patchLookup(v, i, op, "path"); err != nil {
+				return nil, err
+			}
+		}
+		return patchAdd(v, i, op["path"], path, w)
+	case "test":
+		if hasValue {
+			if found && Compare(w, value) == 0 {
+				return v, nil
+			}
+			e := map[string]any{
+				"message": "test failed",
+				"index":   i,
+				"path":    op["path"],
+				"value":   value,
+			}
+			if found {
+				e["actual"] = w
+			}
+			return nil, &exitCodeError{e, 5}
+		}
+	}
+	return nil, &jsonpatchError{i, "invalid operation", x}
+}
+
+// patchLookup resolves the pointer of the operation and looks up the value.
+func patchLookup(v any, i int, op map[string]any, key string) ([]any, any, bool, error) {
+	s, ok := op[key].(string)
+	if !ok {
+		return nil, nil, false, &jsonpatchError{i, "invalid operation", op}
+	}
+	path, err := pointerToPath(v, s)
+	if err != nil {
+		return nil, nil, false, &jsonpatchError{i, "invalid JSON pointer", s}
+	}
+	v, found := lookupPath(v, path)
+	return path, v, found, nil
+}
+
+// lookupPath is similar to getpath, but reports whether the path exists.
+func lookupPath(v any, path []any) (any, bool) {
+	for _, p := range path {
+		switch w := v.(type) {
+		case map[string]any:
+			if k, ok := p.(string); ok {
+				if v, ok = w[k]; ok {
+					continue
+				}
+			}
+		case []any:
+			if j, ok := p.(int); ok && j < len(w) {
+				v = w[j]
+				continue
+			}
+		}
+		return nil, false
+	}
+	return v, true
+}
+
+func patchAdd(v any, i int, p any, path []any, x any) (any, error) {
+	if len(path) == 0 {
+		return x, nil
+	}
+	if w, found := lookupPath(v, path[:len(path)-1]); found {
+		switch w := w.(type) {
+		case map[string]any:
+			return update(v, path, x, nil)
+		case []any:
+			if j, ok := path[len(path)-1].(int); ok && j <= len(w) {
+				return update(v, path[:len(path)-1], slices.Insert(slices.Clone(w), j, x), nil)
+			}
+		}
+	}
+	return nil, &jsonpatchError{i, "path not found", p}
+}
+
+func patchRemove(v any, path []any) (any, error) {
+	u, err := update(v, path, struct{}{}, allocator{})
+	if err != nil {
+		return nil, err
+	}
+	return deleteEmpty(u), nil
+}
+
+func funcJsonpatchDiff(v, w any) any {
+	return diffPatch([]any{}, "", v, w)
+}
+
+func diffPatch(ops []any, p string, v, w any) []any {
+	if Compare(v, w) == 0 {
+		return ops
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		if w, ok := w.(map[string]any); ok {
+			for _, k := range slices.Sorted(maps.Keys(v)) {
+				q := p + "/" + pointerEscaper.Replace(k)
+				if x, ok := w[k]; ok {
+					ops = diffPatch(ops, q, v[k], x)
+				} else {
+					ops = append(ops, map[string]any{"op": "remove", "path": q})
+				}
+			}
+			for _, k := range slices.Sorted(maps.Keys(w)) {
+				if _, ok := v[k]; !ok {
+					q := p + "/" + pointerEscaper.Replace(k)
+					ops = append(ops, map[string]any{"op": "add", "path": q, "value": w[k]})
+				}
+			}
+			return ops
+		}
+	case []any:
+		if w, ok := w.([]any); ok {
+			return diffPatchArray(ops, p, v, w)
+		}
+	}
+	return append(ops, map[string]any{"op": "replace", "path": p, "value": w})
+}
+
+// diffPatchArray computes the edit distance of the arrays, and emits the
+// operations from the end of the arrays so that the indices are not shifted.
+func diffPatchArray(ops []any, p string, v, w []any) []any {
+	var k int
+	for k < len(v) && k < len(w) && Compare(v[k], w[k]) == 0 {
+		k++
+	}
+	v, w = v[k:], w[k:]
+	for len(v) > 0 && len(w) > 0 && Compare(v[len(v)-1], w[len(w)-1]) == 0 {
+		v, w = v[:len(v)-1], w[:len(w)-1]
+	}
+	n, m := len(v), len(w)
+	if n*m > 1<<20 {
+		// Avoids the quadratic memory, replacing the elements at the same indices.
+		for i := n - 1; i >= m; i-- {
+			ops = append(ops, map[string]any{"op": "remove", "path": p + "/" + strconv.Itoa(k+i)})
+		}
+		for i := range min(n, m) {
+			ops = diffPatch(ops, p+"/"+strconv.Itoa(k+i), v[i], w[i])
+		}
+		for i := n; i < m; i++ {
+			ops = append(ops, map[string]any{"op": "add", "path": p + "/" + strconv.Itoa(k+i), "value": w[i]})
+		}
+		return ops
+	}
+	d := make([][]int, n+1)
+	for i := range d {
+		d[i] = make([]int, m+1)
+		d[i][0] = i
+	}
+	for j := range m + 1 {
+		d[0][j] = j
+	}
+	for i := 1; i <= n; i++ {
+		for j := 1; j <= m; j++ {
+			if Compare(v[i-1], w[j-1]) == 0 {
+				d[i][j] = d[i-1][j-1]
+			} else {
+				d[i][j] = min(d[i-1][j-1], d[i-1][j], d[i][j-1]) + 1
+			}
+		}
+	}
+	for i, j := n, m; i > 0 || j > 0; {
+		switch {
+		case i > 0 && j > 0 && Compare(v[i-1], w[j-1]) == 0:
+			i, j = i-1, j-1
+		case i > 0 && d[i][j] == d[i-1][j]+1:
+			ops = append(ops, map[string]any{"op": "remove", "path": p + "/" + strconv.Itoa(k+i-1)})
+			i--
+		case j > 0 && d[i][j] == d[i][j-1]+1:
+			ops = append(ops, map[string]any{"op": "add", "path": p + "/" + strconv.Itoa(k+i), "value": w[j-1]})
+			j--
+		default:
+			ops = diffPatch(ops, p+"/"+strconv.Itoa(k+i-1), v[i-1], w[j-1])
+			i, j = i-1, j-1
+		}
+	}
+	return ops
+}
+
+func parsePointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if s[0] != '/' {
+		return nil, &invalidPointerError{s}
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, token := range tokens {
+		if !strings.Contains(token, "~") {
+			continue
+		}
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' {
+				if j++; j == len(token) || token[j] != '0' && token[j] != '1' {
+					return nil, &invalidPointerError{s}
+				}
+			}
+		}
+		tokens[i] = pointerUnescaper.Replace(token)
+	}
+	return tokens, nil
+}
+
+// pointerIndex parses the array index token, which should not have leading
+// zeros.
+func pointerIndex(token string) (int, bool) {
+	if token == "" || token != "0" && token[0] == '0' {
+		return 0, false
+	}
+	for i := range len(token) {
+		if !isNumber(token[i]) {
+			return 0, false
+		}
+	}
+	i, err := strconv.Atoi(token)
+	return i, err == nil
+}
+
+// pointerToPath converts the JSON pointer to the path array by looking up the
+// value, so that the tokens are array indices only when indexing arrays.
+func pointerToPath(v any, s string) ([]any, error) {
+	tokens, err := parsePointer(s)
+	if err != nil {
+		return nil, err
+	}
+	path := make([]any, len(tokens))
+	for i, token := range tokens {
+		path[i] = token
+		switch w := v.(type) {
+		case []any:
+			if token == "-" {
+				path[i], v = len(w), nil
+			} else if j, ok := pointerIndex(token); ok {
+				path[i], v = j, nil
+				if j < len(w) {
+					v = w[j]
+				}
+			} else {
+				v = nil
+			}
+		case map[string]any:
+			v = w[token]
+		default:
+			v = nil
+		}
+	}
+	return path, nil
+}
+
+func funcTranspose(v any) any {
+	vss, ok := v.([]any)
+	if !ok {
+		return &func0TypeError{"transpose", v}
+	}
+	if len(vss) == 0 {
+		return []any{}
+	}
+	var l int
+	for _, vs := range vss {
+		vs, ok := vs.([]any)
+		if !ok {
+			return &func0TypeError{"transpose", v}
+		}
+		if k := len(vs); l < k {
+			l = k
+		}
+	}
+	wss := make([][]any, l)
 	xs := make([]any, l)
 	for i, k := 0, len(vss); i < l; i++ {
 		s := make([]any, k)
@@ -1839,6 +3242,81 @@ func funcBsearch(v, t any) any {
 	return -i - 1
 }
 
+func hashFunc(name string, f func() hash.Hash) function {
+	return function{
+		argcount0 | argcount1, false, func(v any, args []any) any {
+			h := f()
+			h.Write(hashInput(v))
+			return encodeHash(name, v, args, 0, h.Sum(nil))
+		},
+	}
+}
+
+func funcHmacSha256(v any, args []any) any {
+	key, ok := args[0].(string)
+	if !ok {
+		return funcTypeError("hmac_sha256", v, args)
+	}
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(hashInput(v))
+	return encodeHash("hmac_sha256", v, args, 1, h.Sum(nil))
+}
+
+// hashInput returns the bytes of the string, or the JSON encoding with sorted
+// object keys for the other values. The numbers are normalized, so 1.0 and 1
+// result in the same bytes.
+func hashInput(v any) []byte {
+	if s, ok := v.(string); ok {
+		return []byte(s)
+	}
+	return []byte(jsonMarshal(normalizeHashValue(v)))
+}
+
+func normalizeHashValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		return parseNumber(v)
+	case json.RawMessage:
+		if w := decodeRawMessage(v); w != nil {
+			if _, ok := w.(json.RawMessage); !ok {
+				return normalizeHashValue(w)
+			}
+		}
+		return v
+	case []any:
+		vs := make([]any, len(v))
+		for i, v := range v {
+			vs[i] = normalizeHashValue(v)
+		}
+		return vs
+	case map[string]any:
+		vs := make(map[string]any, len(v))
+		for k, v := range v {
+			vs[k] = normalizeHashValue(v)
+		}
+		return vs
+	default:
+		return v
+	}
+}
+
+func encodeHash(name string, v any, args []any, i int, b []byte) any {
+	if i >= len(args) {
+		return hex.EncodeToString(b)
+	}
+	switch args[i] {
+	case "hex":
+		return hex.EncodeToString(b)
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b)
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(b)
+	default:
+		return funcWrapError(name, v, args,
+			errors.New(`encoding should be "hex", "base64", or "base64url"`))
+	}
+}
+
 func funcGmtime(v any) any {
 	if v, ok := toFloat(v); ok {
 		return epochToArray(v, time.UTC)
@@ -1846,11 +3324,15 @@ func funcGmtime(v any) any {
 	return &func0TypeError{"gmtime", v}
 }
 
-func funcLocaltime(v any) any {
+func funcLocaltime(v any, args []any) any {
+	loc, err := locationArg("localtime", v, args, 0, time.Local)
+	if err != nil {
+		return err
+	}
 	if v, ok := toFloat(v); ok {
-		return epochToArray(v, time.Local)
+		return epochToArray(v, loc)
 	}
-	return &func0TypeError{"localtime", v}
+	return funcTypeError("localtime", v, args)
 }
 
 func epochToArray(v float64, loc *time.Location) []any {
@@ -1867,14 +3349,18 @@ func epochToArray(v float64, loc *time.Location) []any {
 	}
 }
 
-func funcMktime(v any) any {
+func funcMktime(v any, args []any) any {
 	a, ok := v.([]any)
 	if !ok {
-		return &func0TypeError{"mktime", v}
+		return funcTypeError("mktime", v, args)
+	}
+	loc, err := locationArg("mktime", v, args, 0, time.UTC)
+	if err != nil {
+		return err
 	}
-	t, err := arrayToTime(a, time.UTC)
+	t, err := arrayToTime(a, loc)
 	if err != nil {
-		return &func0WrapError{"mktime", v, err}
+		return funcWrapError("mktime", v, args, err)
 	}
 	return timeToEpoch(t)
 }
@@ -1883,21 +3369,25 @@ func timeToEpoch(t time.Time) float64 {
 	return float64(t.Unix()) + float64(t.Nanosecond())/1e9
 }
 
-func funcStrftime(v, x any) any {
+func funcStrftime(v any, args []any) any {
+	loc, err := locationArg("strftime", v, args, 1, time.UTC)
+	if err != nil {
+		return err
+	}
 	if w, ok := toFloat(v); ok {
-		v = epochToArray(w, time.UTC)
+		v = epochToArray(w, loc)
 	}
 	a, ok := v.([]any)
 	if !ok {
-		return &func1TypeError{"strftime", v, x}
+		return funcTypeError("strftime", v, args)
 	}
-	format, ok := x.(string)
+	format, ok := args[0].(string)
 	if !ok {
-		return &func1TypeError{"strftime", v, x}
+		return funcTypeError("strftime", v, args)
 	}
-	t, err := arrayToTime(a, time.UTC)
+	t, err := arrayToTime(a, loc)
 	if err != nil {
-		return &func1WrapError{"strftime", v, x, err}
+		return funcWrapError("strftime", v, args, err)
 	}
 	return timefmt.Format(t, format)
 }
@@ -1921,23 +3411,27 @@ func funcStrflocaltime(v, x any) any {
 	return timefmt.Format(t, format)
 }
 
-func funcStrptime(v, x any) any {
+func funcStrptime(v any, args []any) any {
 	s, ok := v.(string)
 	if !ok {
-		return &func1TypeError{"strptime", v, x}
+		return funcTypeError("strptime", v, args)
 	}
-	format, ok := x.(string)
+	format, ok := args[0].(string)
 	if !ok {
-		return &func1TypeError{"strptime", v, x}
+		return funcTypeError("strptime", v, args)
+	}
+	loc, err := locationArg("strptime", v, args, 1, time.UTC)
+	if err != nil {
+		return err
 	}
-	t, err := timefmt.Parse(s, format)
+	t, err := timefmt.ParseInLocation(s, format, loc)
 	if err != nil {
-		return &func1WrapError{"strptime", v, x, err}
+		return funcWrapError("strptime", v, args, err)
 	}
 	if t.Equal(time.Time{}) {
-		return &func1TypeError{"strptime", v, x}
+		return funcTypeError("strptime", v, args)
 	}
-	return epochToArray(timeToEpoch(t), time.UTC)
+	return epochToArray(timeToEpoch(t), loc)
 }
 
 func arrayToTime(a []any, loc *time.Location) (time.Time, error) {
@@ -1968,11 +3462,464 @@ func arrayToTime(a []any, loc *time.Location) (time.Time, error) {
 		hour, minute, second, nanosecond, loc), nil
 }
 
+var locations sync.Map // map[string]*time.Location
+
+func locationArg(name string, v any, args []any, i int, loc *time.Location) (*time.Location, error) {
+	if i >= len(args) {
+		return loc, nil
+	}
+	tz, ok := args[i].(string)
+	if !ok {
+		return nil, funcTypeError(name, v, args)
+	}
+	loc, err := loadLocation(tz)
+	if err != nil {
+		return nil, funcWrapError(name, v, args, err)
+	}
+	return loc, nil
+}
+
+// loadLocation loads the time zone by the IANA name like "Asia/Tokyo", or the
+// fixed offset like "+09:00".
+func loadLocation(tz string) (*time.Location, error) {
+	if loc, ok := locations.Load(tz); ok {
+		return loc.(*time.Location), nil
+	}
+	var loc *time.Location
+	if offset, ok := parseZoneOffset(tz); ok {
+		loc = time.FixedZone(tz, offset)
+	} else {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, err
+		}
+	}
+	locations.Store(tz, loc)
+	return loc, nil
+}
+
+func parseZoneOffset(tz string) (int, bool) {
+	if tz == "Z" {
+		return 0, true
+	}
+	if len(tz) < 3 || tz[0] != '+' && tz[0] != '-' {
+		return 0, false
+	}
+	hh, mm := tz[1:3], tz[3:]
+	if len(mm) == 3 && mm[0] == ':' {
+		mm = mm[1:]
+	}
+	if mm == "" {
+		mm = "00"
+	} else if len(mm) != 2 {
+		return 0, false
+	}
+	for _, c := range []byte(hh + mm) {
+		if !isNumber(c) {
+			return 0, false
+		}
+	}
+	h, m := int(hh[0]-'0')*10+int(hh[1]-'0'), int(mm[0]-'0')*10+int(mm[1]-'0')
+	if h > 23 || m > 59 {
+		return 0, false
+	}
+	offset := (h*60 + m) * 60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return offset, true
+}
+
+func epochToTime(v float64, loc *time.Location) time.Time {
+	sec := math.Floor(v)
+	return time.Unix(int64(sec), int64((v-sec)*1e9)).In(loc)
+}
+
+func funcDateadd(v any, args []any) any {
+	return dateAdd("dateadd", v, args, 1)
+}
+
+func funcDatesub(v any, args []any) any {
+	return dateAdd("datesub", v, args, -1)
+}
+
+func dateAdd(name string, v any, args []any, sign float64) any {
+	x, ok := toFloat(v)
+	if !ok {
+		return funcTypeError(name, v, args)
+	}
+	unit, ok := args[0].(string)
+	if !ok {
+		return funcTypeError(name, v, args)
+	}
+	n, ok := toFloat(args[1])
+	if !ok {
+		return funcTypeError(name, v, args)
+	}
+	loc, err := locationArg(name, v, args, 2, time.UTC)
+	if err != nil {
+		return err
+	}
+	if unit, err = toTimeUnit(unit); err != nil {
+		return funcWrapError(name, v, args, err)
+	}
+	if !validEpoch(x) {
+		return funcWrapError(name, v, args, errors.New("epoch is out of range"))
+	}
+	n *= sign
+	switch unit {
+	case "second":
+		return x + n
+	case "minute":
+		return x + n*60
+	case "hour":
+		return x + n*3600
+	}
+	if math.Trunc(n) != n || math.IsInf(n, 0) {
+		return funcWrapError(name, v, args,
+			fmt.Errorf("number of %ss should be an integer", unit))
+	}
+	if math.Abs(n) > 1<<32 {
+		return funcWrapError(name, v, args,
+			fmt.Errorf("number of %ss is out of range", unit))
+	}
+	return timeToEpoch(addTimeUnit(epochToTime(x, loc), unit, floatToInt(n)))
+}
+
+// validEpoch reports whether the epoch is finite and small enough to add the
+// time units without overflowing [time.Time].
+func validEpoch(x float64) bool {
+	return math.Abs(x) <= 1<<62
+}
+
+func funcDatediff(v any, args []any) any {
+	x, ok := toFloat(v)
+	if !ok {
+		return funcTypeError("datediff", v, args)
+	}
+	unit, ok := args[0].(string)
+	if !ok {
+		return funcTypeError("datediff", v, args)
+	}
+	y, ok := toFloat(args[1])
+	if !ok {
+		return funcTypeError("datediff", v, args)
+	}
+	loc, err := locationArg("datediff", v, args, 2, time.UTC)
+	if err != nil {
+		return err
+	}
+	if unit, err = toTimeUnit(unit); err != nil {
+		return funcWrapError("datediff", v, args, err)
+	}
+	if !validEpoch(x) || !validEpoch(y) {
+		return funcWrapError("datediff", v, args, errors.New("epoch is out of range"))
+	}
+	switch unit {
+	case "second":
+		return math.Trunc(y - x)
+	case "minute":
+		return math.Trunc((y - x) / 60)
+	case "hour":
+		return math.Trunc((y - x) / 3600)
+	}
+	t, u := epochToTime(x, loc), epochToTime(y, loc)
+	sign := 1
+	if y < x {
+		sign = -1
+	}
+	// estimate the difference from below, and then adjust it by adding the units
+	var n int
+	switch days := floatToInt(math.Abs(y-x) / 86400); unit {
+	case "day":
+		n = days - 1
+	case "week":
+		n = days/7 - 1
+	case "weekday":
+		n = days/7*5 - 5
+	default:
+		months := (u.Year()-t.Year())*12 + int(u.Month()) - int(t.Month())
+		if months < 0 {
+			months = -months
+		}
+		if unit == "year" {
+			months /= 12
+		}
+		n = months - 1
+	}
+	exceeds := func(n int) bool {
+		s := addTimeUnit(t, unit, sign*n)
+		return sign > 0 && s.After(u) || sign < 0 && s.Before(u)
+	}
+	n = max(n, 0)
+	for n > 0 && exceeds(n) {
+		n--
+	}
+	for !exceeds(n + 1) {
+		n++
+	}
+	return sign * n
+}
+
+func toTimeUnit(unit string) (string, error) {
+	switch u := strings.TrimSuffix(unit, "s"); u {
+	case "second", "minute", "hour", "day", "week", "weekday", "month", "year":
+		return u, nil
+	default:
+		return "", fmt.Errorf("unknown time unit: %q", unit)
+	}
+}
+
+func addTimeUnit(t time.Time, unit string, n int) time.Time {
+	switch unit {
+	case "day":
+		return t.AddDate(0, 0, n)
+	case "week":
+		return t.AddDate(0, 0, n*7)
+	case "weekday":
+		return addWeekdays(t, n)
+	case "month":
+		return addMonths(t, n)
+	default:
+		return addMonths(t, n*12)
+	}
+}
+
+// addMonths adds the months to the time, clamping the day to the end of the
+// month (Jan 31 + 1 month is Feb 28 or 29).
+func addMonths(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	u := time.Date(y, m+time.Month(n), 1,
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	return u.AddDate(0, 0, min(d, u.AddDate(0, 1, -1).Day())-1)
+}
+
+// addWeekdays adds the business days (Monday to Friday) to the time. Adding to
+// a weekend starts from the adjacent weekday, so Saturday + 1 is Monday.
+func addWeekdays(t time.Time, n int) time.Time {
+	if n == 0 {
+		return t
+	}
+	step := 1
+	if n < 0 {
+		step = -1
+	}
+	switch w := t.Weekday(); {
+	case w == time.Saturday && step > 0:
+		t = t.AddDate(0, 0, -1)
+	case w == time.Sunday && step > 0:
+		t = t.AddDate(0, 0, -2)
+	case w == time.Saturday:
+		t = t.AddDate(0, 0, 2)
+	case w == time.Sunday:
+		t = t.AddDate(0, 0, 1)
+	}
+	t, n = t.AddDate(0, 0, n/5*7), n%5
+	for n != 0 {
+		t = t.AddDate(0, 0, step)
+		if w := t.Weekday(); w != time.Saturday && w != time.Sunday {
+			n -= step
+		}
+	}
+	return t
+}
+
+func funcFromdurationiso8601(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return &func0TypeError{"fromdurationiso8601", v}
+	}
+	d, err := parseDurationISO8601(s)
+	if err != nil {
+		return &func0WrapError{"fromdurationiso8601", v, err}
+	}
+	return d
+}
+
+// parseDurationISO8601 parses the duration like "P1DT2H30M" and returns the
+// seconds. The years and months are rejected since their lengths vary.
+func parseDurationISO8601(s string) (float64, error) {
+	var sign float64 = 1
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		if s[0] == '-' {
+			sign = -1
+		}
+		s = s[1:]
+	}
+	if len(s) < 2 || s[0] != 'P' {
+		return 0, errors.New("invalid duration")
+	}
+	var d float64
+	var order int
+	var inTime, fraction bool
+	for s = s[1:]; s != ""; {
+		if s[0] == 'T' {
+			if inTime || len(s) == 1 {
+				return 0, errors.New("invalid duration")
+			}
+			inTime, s = true, s[1:]
+			continue
+		}
+		var i int
+		for i < len(s) && (isNumber(s[i]) || s[i] == '.' || s[i] == ',') {
+			i++
+		}
+		if i == 0 || i == len(s) || fraction {
+			return 0, errors.New("invalid duration")
+		}
+		x, err := strconv.ParseFloat(strings.Replace(s[:i], ",", ".", 1), 64)
+		if err != nil {
+			return 0, errors.New("invalid duration")
+		}
+		fraction = strings.ContainsAny(s[:i], ".,")
+		var o int
+		var unit float64
+		switch c := s[i]; {
+		case !inTime && (c == 'Y' || c == 'M'):
+			return 0, errors.New("years and months are not supported")
+		case !inTime && c == 'W':
+			o, unit = 1, 7*86400
+		case !inTime && c == 'D':
+			o, unit = 2, 86400
+		case inTime && c == 'H':
+			o, unit = 3, 3600
+		case inTime && c == 'M':
+			o, unit = 4, 60
+		case inTime && c == 'S':
+			o, unit = 5, 1
+		default:
+			return 0, errors.New("invalid duration")
+		}
+		if o <= order {
+			return 0, errors.New("invalid duration")
+		}
+		order, d, s = o, d+x*unit, s[i+1:]
+	}
+	return sign * d, nil
+}
+
+func funcTodurationiso8601(v any) any {
+	x, ok := toFloat(v)
+	if !ok {
+		return &func0TypeError{"todurationiso8601", v}
+	}
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return &func0WrapError{"todurationiso8601", v, errors.New("invalid duration")}
+	}
+	return formatDurationISO8601(x)
+}
+
+// formatDurationISO8601 formats the seconds like "P1DT2H30M", using the days
+// as the largest unit.
+func formatDurationISO8601(x float64) string {
+	var sb strings.Builder
+	if x < 0 {
+		sb.WriteByte('-')
+		x = -x
+	}
+	sb.WriteByte('P')
+	sec := math.Floor(x)
+	nsec := int64(math.Round((x - sec) * 1e9))
+	if nsec >= 1e9 {
+		sec, nsec = sec+1, nsec-1e9
+	}
+	days := math.Floor(sec / 86400)
+	if days > 0 {
+		sb.WriteString(strconv.FormatFloat(days, 'f', 0, 64))
+		sb.WriteByte('D')
+	}
+	sec -= days * 86400
+	h, m, s := int(sec)/3600, int(sec)/60%60, int(sec)%60
+	if h == 0 && m == 0 && s == 0 && nsec == 0 {
+		if days == 0 {
+			sb.WriteString("T0S")
+		}
+		return sb.String()
+	}
+	sb.WriteByte('T')
+	if h > 0 {
+		sb.WriteString(strconv.Itoa(h))
+		sb.WriteByte('H')
+	}
+	if m > 0 {
+		sb.WriteString(strconv.Itoa(m))
+		sb.WriteByte('M')
+	}
+	if s > 0 || nsec > 0 {
+		sb.WriteString(strconv.Itoa(s))
+		if nsec > 0 {
+			sb.WriteString(strings.TrimRight(fmt.Sprintf(".%09d", nsec), "0"))
+		}
+		sb.WriteByte('S')
+	}
+	return sb.String()
+}
+
 func funcNow(any) any {
 	return timeToEpoch(time.Now())
 }
 
-func funcMatch(v, re, fs, testing any, cache *sync.Map) any {
+func funcRandom(_ any, _ []any, r *rand.Rand) any {
+	return r.Float64()
+}
+
+func funcRandomInt(v any, args []any, r *rand.Rand) any {
+	lo, ok := toInt(args[0])
+	if !ok {
+		return &func2TypeError{"random_int", v, args[0], args[1]}
+	}
+	hi, ok := toInt(args[1])
+	if !ok {
+		return &func2TypeError{"random_int", v, args[0], args[1]}
+	}
+	if lo >= hi {
+		return &func2WrapError{"random_int", v, args[0], args[1],
+			errors.New("upper bound should be larger than lower bound")}
+	}
+	return lo + int(r.Uint64N(uint64(hi)-uint64(lo)))
+}
+
+func funcShuffle(v any, _ []any, r *rand.Rand) any {
+	vs, ok := v.([]any)
+	if !ok {
+		return &func0TypeError{"shuffle", v}
+	}
+	vs = slices.Clone(vs)
+	r.Shuffle(len(vs), func(i, j int) { vs[i], vs[j] = vs[j], vs[i] })
+	return vs
+}
+
+func funcSample(v any, args []any, r *rand.Rand) any {
+	vs, ok := v.([]any)
+	if !ok {
+		return &func1TypeError{"sample", v, args[0]}
+	}
+	n, ok := toInt(args[0])
+	if !ok {
+		return &func1TypeError{"sample", v, args[0]}
+	}
+	if n < 0 {
+		return &func1WrapError{"sample", v, args[0],
+			errors.New("sample size should not be negative")}
+	}
+	vs, n = slices.Clone(vs), min(n, len(vs))
+	for i := range n {
+		j := i + r.IntN(len(vs)-i)
+		vs[i], vs[j] = vs[j], vs[i]
+	}
+	return vs[:n:n]
+}
+
+func funcUUID4(_ any, _ []any, r *rand.Rand) any {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], r.Uint64())
+	binary.BigEndian.PutUint64(b[8:], r.Uint64())
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func funcMatch(v, re, fs, testing any, engine RegexpEngine, cache *sync.Map) any {
 	var name string
 	if testing == true {
 		name = "test"
@@ -1995,20 +3942,23 @@ func funcMatch(v, re, fs, testing any, cache *sync.Map) any {
 	if !ok {
 		return &func2TypeError{name, v, re, fs}
 	}
-	r, err := compileRegexp(restr, flags, cache)
+	r, err := compileRegexp(restr, flags, engine, cache)
 	if err != nil {
 		return err
 	}
-	if testing == true {
-		return r.MatchString(s)
-	}
 	var n int
-	if strings.ContainsRune(flags, 'g') {
+	if testing != true && strings.ContainsRune(flags, 'g') {
 		n = -1
 	} else {
 		n = 1
 	}
-	xs := r.FindAllStringSubmatchIndex(s, n)
+	xs, err := r.FindAllStringSubmatchIndex(s, n)
+	if err != nil {
+		return err
+	}
+	if testing == true {
+		return len(xs) > 0
+	}
 	res, names := make([]any, len(xs)), r.SubexpNames()
 	for i, x := range xs {
 		captures := make([]any, (len(x)-2)/2)
@@ -2043,25 +3993,14 @@ func funcMatch(v, re, fs, testing any, cache *sync.Map) any {
 	return res
 }
 
-func compileRegexp(re, flags string, cache *sync.Map) (*regexp.Regexp, error) {
+func compileRegexp(re, flags string, engine RegexpEngine, cache *sync.Map) (Regexp, error) {
 	key := [2]string{re, flags}
 	if r, ok := cache.Load(key); ok {
-		return r.(*regexp.Regexp), nil
+		return r.(Regexp), nil
 	}
-	if strings.IndexFunc(flags, func(r rune) bool {
-		return r != 'g' && r != 'i' && r != 'm'
-	}) >= 0 {
-		return nil, fmt.Errorf("unsupported regular expression flag: %q", flags)
-	}
-	if strings.ContainsRune(flags, 'i') {
-		re = "(?i)" + re
-	}
-	if strings.ContainsRune(flags, 'm') {
-		re = "(?s)" + re
-	}
-	r, err := regexp.Compile(re)
+	r, err := engine.Compile(re, flags)
 	if err != nil {
-		return nil, fmt.Errorf("invalid regular expression %q: %s", re, err)
+		return nil, err
 	}
 	cache.Store(key, r)
 	return r, nil
@@ -2128,6 +4067,44 @@ func toInt(x any) (int, bool) {
 	}
 }
 
+// toInteger converts the number to int or *big.Int without losing precision.
+// This returns false for the numbers with fractional part.
+func toInteger(x any) (any, bool) {
+	switch x := x.(type) {
+	case int, *big.Int:
+		return x, true
+	case float64:
+		if math.Trunc(x) != x || math.IsInf(x, 0) {
+			return nil, false
+		}
+		if math.MinInt <= x && x < math.MaxInt {
+			return int(x), true
+		}
+		y, _ := big.NewFloat(x).Int(nil)
+		return y, true
+	case json.Number:
+		return toInteger(parseNumber(x))
+	default:
+		return nil, false
+	}
+}
+
+func toBigInt(x any) *big.Int {
+	if x, ok := x.(*big.Int); ok {
+		return x
+	}
+	return big.NewInt(int64(x.(int)))
+}
+
+func normalizeBigInt(x *big.Int) any {
+	if x.IsInt64() {
+		if i := x.Int64(); math.MinInt <= i && i <= math.MaxInt {
+			return int(i)
+		}
+	}
+	return x
+}
+
 func toIntCeil(x any) (int, bool) {
 	if f, ok := x.(float64); ok {
 		x = math.Ceil(f)
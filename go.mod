@@ -3,15 +3,17 @@ module github.com/itchyny/gojq
 go 1.24.0
 
 require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/clipperhouse/uax29/v2 v2.3.0
 	github.com/google/go-cmp v0.7.0
 	github.com/itchyny/go-yaml v0.0.0-20251001235044-fca9a0999f15
 	github.com/itchyny/timefmt-go v0.1.8
 	github.com/mattn/go-isatty v0.0.20
 	github.com/mattn/go-runewidth v0.0.19
+	golang.org/x/text v0.34.0
 )
 
 require (
 	github.com/clipperhouse/stringish v0.1.1 // indirect
-	github.com/clipperhouse/uax29/v2 v2.3.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 )
@@ -5,6 +5,23 @@ type Iter interface {
 	Next() (any, bool)
 }
 
+// InputMetadataIter is an optional interface of the input iterator specified
+// by [WithInputIter], which provides the metadata of the last emitted value for
+// input_filename, input_line_number, and input_offset functions. The metadata
+// is requested only when these functions are called, so the iterator can
+// compute the line number on demand.
+type InputMetadataIter interface {
+	Iter
+	InputMetadata() InputMetadata
+}
+
+// InputMetadata is the metadata of an input value.
+type InputMetadata struct {
+	Filename string // the name of the input file, or empty if not available
+	Offset   int64  // the byte offset of the value, or -1 if not available
+	Line     int    // the line number (1-origin) of the value, or 0 if not available
+}
+
 // NewIter creates a new [Iter] from values.
 func NewIter[T any](values ...T) Iter {
 	switch len(values) {
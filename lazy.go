@@ -0,0 +1,301 @@
+package gojq
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// lazyValue is a JSON value decoded on demand. The input values of type
+// [json.RawMessage] are converted to this type on entering the execution, and
+// indexing and iterating the value do not decode the whole value but return
+// the lazy values of the children. The value is decoded when it is passed to
+// a function, and emitted as [json.RawMessage] so untouched values are encoded
+// byte-for-byte. Note that the raw bytes are already validated.
+type lazyValue struct {
+	raw     []byte
+	value   any
+	decoded bool
+}
+
+// validRawJSON is the bytes of a JSON value validated by [*Decoder.DecodeLazy].
+type validRawJSON []byte
+
+// toLazyValue converts v to a *lazyValue when v is a [json.RawMessage], which
+// is validated here, or the bytes already validated by the decoder.
+func toLazyValue(v any) (any, error) {
+	switch v := v.(type) {
+	case json.RawMessage:
+		raw := bytes.TrimSpace(v)
+		if !json.Valid(raw) {
+			var v any
+			return nil, &rawJSONError{raw, json.Unmarshal(raw, &v)}
+		}
+		return &lazyValue{raw: raw}, nil
+	case validRawJSON:
+		return &lazyValue{raw: v}, nil
+	default:
+		return v, nil
+	}
+}
+
+// fromLazyValue converts a *lazyValue to the decoded value.
+func fromLazyValue(v any) any {
+	if v, ok := v.(*lazyValue); ok {
+		return v.get()
+	}
+	return v
+}
+
+// exportLazyValue converts a *lazyValue to a [json.RawMessage].
+func exportLazyValue(v any) any {
+	if v, ok := v.(*lazyValue); ok {
+		return json.RawMessage(v.raw)
+	}
+	return v
+}
+
+// decodeRawMessage decodes v when v is a valid [json.RawMessage].
+func decodeRawMessage(v any) any {
+	if w, err := toLazyValue(v); err == nil {
+		if w, ok := w.(*lazyValue); ok {
+			return w.get()
+		}
+	}
+	return v
+}
+
+// inputIgnoredFuncs is the set of the internal functions which do not use the
+// input value, like the operators. The lazy input is not decoded on calling.
+var inputIgnoredFuncs = map[string]bool{
+	"_index": true, "_slice": true, "_range": true,
+	"_add": true, "_subtract": true, "_multiply": true, "_divide": true,
+	"_modulo": true, "_alternative": true, "_equal": true, "_notequal": true,
+	"_greater": true, "_less": true, "_greatereq": true, "_lesseq": true,
+	"input_filename": true, "input_line_number": true, "input_offset": true,
+}
+
+func (v *lazyValue) get() any {
+	if !v.decoded {
+		v.value, v.decoded = decodeRawJSON(v.raw), true
+	}
+	return v.value
+}
+
+func (v *lazyValue) typeOf() string {
+	return rawTypeOf(v.raw)
+}
+
+func (v *lazyValue) truthy() bool {
+	return v.raw[0] != 'n' && v.raw[0] != 'f'
+}
+
+// index returns the lazy value of the object member or the array element. The
+// second return value is false when the fallback to the decoded value is
+// required, like indexing the values of different types.
+func (v *lazyValue) index(p any) (any, bool) {
+	switch p := p.(type) {
+	case string:
+		if v.raw[0] != '{' {
+			return nil, false
+		}
+		var w []byte
+		scanRawObject(v.raw, func(k, x []byte) {
+			if rawStringEqual(k, p) {
+				w = x
+			}
+		})
+		if w == nil {
+			return nil, true
+		}
+		return &lazyValue{raw: w}, true
+	case int:
+		if v.raw[0] != '[' || p < 0 {
+			return nil, false
+		}
+		var w []byte
+		scanRawArray(v.raw, func(i int, x []byte) bool {
+			if i == p {
+				w = x
+			}
+			return i < p
+		})
+		if w == nil {
+			return nil, true
+		}
+		return &lazyValue{raw: w}, true
+	default:
+		return nil, false
+	}
+}
+
+// entries returns the pairs of the keys and the lazy values of the children,
+// in the order of the sorted keys for objects. The second return value is
+// false when the value is neither an object nor an array.
+func (v *lazyValue) entries() ([]pathValue, bool) {
+	var xs []pathValue
+	switch v.raw[0] {
+	case '{':
+		scanRawObject(v.raw, func(k, x []byte) {
+			xs = append(xs, pathValue{path: decodeRawString(k), value: &lazyValue{raw: x}})
+		})
+		slices.SortStableFunc(xs, func(x, y pathValue) int {
+			return strings.Compare(x.path.(string), y.path.(string))
+		})
+		// the last member wins like decoding into a map
+		ys := xs[:0]
+		for i, x := range xs {
+			if i+1 == len(xs) || xs[i+1].path != x.path {
+				ys = append(ys, x)
+			}
+		}
+		xs = ys
+	case '[':
+		scanRawArray(v.raw, func(i int, x []byte) bool {
+			xs = append(xs, pathValue{path: i, value: &lazyValue{raw: x}})
+			return true
+		})
+	default:
+		return nil, false
+	}
+	return xs, true
+}
+
+// rawTypeOf returns the type name of the JSON value by the first byte, or an
+// empty string when the byte cannot start a JSON value.
+func rawTypeOf(raw []byte) string {
+	switch raw[0] {
+	case 'n':
+		return "null"
+	case 't', 'f':
+		return "boolean"
+	case '"':
+		return "string"
+	case '[':
+		return "array"
+	case '{':
+		return "object"
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return "number"
+	default:
+		return ""
+	}
+}
+
+func decodeRawJSON(raw []byte) any {
+	switch raw[0] {
+	case 'n':
+		return nil
+	case 't':
+		return true
+	case 'f':
+		return false
+	case '"':
+		return decodeRawString(raw)
+	case '{', '[':
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		var v any
+		_ = dec.Decode(&v)
+		return v
+	default:
+		return json.Number(raw)
+	}
+}
+
+func decodeRawString(raw []byte) string {
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw[1 : len(raw)-1])
+	}
+	var s string
+	_ = json.Unmarshal(raw, &s)
+	return s
+}
+
+func rawStringEqual(raw []byte, s string) bool {
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw[1:len(raw)-1]) == s
+	}
+	return decodeRawString(raw) == s
+}
+
+func scanRawObject(raw []byte, f func(k, v []byte)) {
+	for i := skipRawSpace(raw, 1); raw[i] != '}'; {
+		j := skipRawValue(raw, i)
+		k := raw[i:j]
+		i = skipRawSpace(raw, skipRawSpace(raw, j)+1)
+		j = skipRawValue(raw, i)
+		f(k, raw[i:j])
+		if i = skipRawSpace(raw, j); raw[i] == ',' {
+			i = skipRawSpace(raw, i+1)
+		}
+	}
+}
+
+func scanRawArray(raw []byte, f func(i int, v []byte) bool) {
+	for i, n := skipRawSpace(raw, 1), 0; raw[i] != ']'; n++ {
+		j := skipRawValue(raw, i)
+		if !f(n, raw[i:j]) {
+			return
+		}
+		if i = skipRawSpace(raw, j); raw[i] == ',' {
+			i = skipRawSpace(raw, i+1)
+		}
+	}
+}
+
+func skipRawSpace(raw []byte, i int) int {
+	for ; i < len(raw); i++ {
+		switch raw[i] {
+		case ' ', '\t', '\n', '\r':
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipRawValue returns the end index of the value starting at i.
+func skipRawValue(raw []byte, i int) int {
+	switch raw[i] {
+	case '"':
+		return skipRawString(raw, i)
+	case '{', '[':
+		for depth := 0; i < len(raw); {
+			switch raw[i] {
+			case '"':
+				i = skipRawString(raw, i)
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+			i++
+		}
+		return i
+	default:
+		for ; i < len(raw); i++ {
+			switch raw[i] {
+			case ',', '}', ']', ' ', '\t', '\n', '\r':
+				return i
+			}
+		}
+		return i
+	}
+}
+
+func skipRawString(raw []byte, i int) int {
+	for i++; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return i
+}
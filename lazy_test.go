@@ -0,0 +1,236 @@
+package gojq_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func ExampleCode_Run_rawMessage() {
+	query, err := gojq.Parse(`select(.level == "error") | .service, .request`)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	input := json.RawMessage(`{"level": "error", "service": "api", "request": {"path": "/", "id": 1}}`)
+	iter := code.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			log.Fatalln(err)
+		}
+		fmt.Printf("%s\n", v.(json.RawMessage))
+	}
+
+	// Output:
+	// "api"
+	// {"path": "/", "id": 1}
+}
+
+func TestCodeRunRawMessage(t *testing.T) {
+	queries := []string{
+		`.`,
+		`.a`,
+		`.a.b`,
+		`.[0]`,
+		`.[1:]`,
+		`.[-1]`,
+		`.[]`,
+		`.[]?`,
+		`.a[]`,
+		`.a[].b`,
+		`.. | numbers`,
+		`[paths]`,
+		`path(.a[0].b)`,
+		`[.[] | type]`,
+		`.a | length`,
+		`.a // "default"`,
+		`select(.a) | .b`,
+		`if .a then 1 else 2 end`,
+		`{a, b: .b}`,
+		`[.a, .b]`,
+		`.a + .b`,
+		`.a == .b`,
+		`.a as [$x, $y] | [$x, $y]`,
+		`. as {a: $x} | $x`,
+		`.a |= 1`,
+		`to_entries`,
+		`tojson`,
+		`reduce .[] as $x (0; . + 1)`,
+		`try error(.) catch .`,
+		`"\(.a)"`,
+	}
+	inputs := []string{
+		`null`,
+		`true`,
+		`false`,
+		`1`,
+		`"a\"b"`,
+		`[]`,
+		`{}`,
+		`[1, [2, 3], {"b": 4}]`,
+		`{"a": null, "b": false}`,
+		`{"a": [{"b": 1}, {"b": "x"}], "b": {"c": 2}}`,
+		`{"a": 1, "b": 2, "a": 3}`,
+		`{"b": 1, "ab": [1, 2], "a": "x y"}`,
+		` { "a" : [ 1 , 2 ] , "b" : { } } `,
+	}
+	for _, src := range queries {
+		t.Run(src, func(t *testing.T) {
+			query, err := gojq.Parse(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := gojq.Compile(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, input := range inputs {
+				var v any
+				dec := json.NewDecoder(strings.NewReader(input))
+				dec.UseNumber()
+				if err := dec.Decode(&v); err != nil {
+					t.Fatal(err)
+				}
+				expected := collectValues(code.Run(v))
+				got := collectValues(code.Run(json.RawMessage(input)))
+				for i, v := range got {
+					if raw, ok := v.(json.RawMessage); ok {
+						dec := json.NewDecoder(strings.NewReader(string(raw)))
+						dec.UseNumber()
+						if err := dec.Decode(&got[i]); err != nil {
+							t.Fatal(err)
+						}
+					}
+				}
+				if !reflect.DeepEqual(got, expected) {
+					t.Errorf("input: %s\nexpected: %v\n     got: %v", input, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCodeRunRawMessageUntouched(t *testing.T) {
+	query, err := gojq.Parse(`.a, .b[1], (.c | .), .d`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := json.RawMessage(` {"a": {"y": 1.0, "x": [ ]}, "b": [0, 1e2], "c": "a", "d": 1} `)
+	got := collectValues(code.Run(input))
+	expected := []any{
+		json.RawMessage(`{"y": 1.0, "x": [ ]}`),
+		json.RawMessage(`1e2`),
+		json.RawMessage(`"a"`),
+		json.RawMessage(`1`),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+	for i, expected := range []string{`{"x":[],"y":1.0}`, `1e2`, `"a"`, `1`} {
+		if got, _ := gojq.Marshal(got[i]); string(got) != expected {
+			t.Errorf("expected: %s, got: %s", expected, got)
+		}
+	}
+	input = json.RawMessage(` {"b": [ "\u0041" ], "a": 1, "b": {"y": {}, "x": null}} `)
+	if got, expected := jsonMarshal(t, input), `{"a":1,"b":{"x":null,"y":{}}}`; got != expected {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+	input = json.RawMessage(`["\u0041\/", "\u00e9"]`)
+	if got, expected := jsonMarshal(t, input), `["A/","é"]`; got != expected {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+}
+
+func jsonMarshal(t *testing.T, v any) string {
+	t.Helper()
+	got, err := gojq.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(got)
+}
+
+func TestCodeRunRawMessageError(t *testing.T) {
+	query, err := gojq.Parse(`.`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := code.Run(json.RawMessage(`{"a": 1`)).Next()
+	err, ok := v.(error)
+	if !ok {
+		t.Fatalf("should emit an error but got: %v", v)
+	}
+	if expected := `invalid json: "{\"a\": 1": unexpected end of JSON input`; err.Error() != expected {
+		t.Errorf("expected: %v, got: %v", expected, err)
+	}
+}
+
+func TestCodeRunDecodeLazy(t *testing.T) {
+	query, err := gojq.Parse(`.a, (.b | type), .b[0]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := gojq.NewDecoder(strings.NewReader(`{"a": [ 1 ], "b": [2]} {"a": 3, "b": [NaN]}`))
+	dec.AllowNonFinite()
+	var got []any
+	for {
+		v, err := dec.DecodeLazy()
+		if err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			break
+		}
+		got = append(got, collectValues(code.Run(v))...)
+	}
+	expected := []any{
+		json.RawMessage(`[ 1 ]`), "array", json.RawMessage(`2`),
+		3, "array", math.NaN(),
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+}
+
+func TestRawMessageTypeOfCompare(t *testing.T) {
+	for raw, expected := range map[string]string{
+		`null`: "null", `false`: "boolean", `-1`: "number", ` "a" `: "string",
+		`[1]`: "array", `{"a": 1}`: "object", `{"a": `: "object",
+	} {
+		if got := gojq.TypeOf(json.RawMessage(raw)); got != expected {
+			t.Errorf("TypeOf(%s): expected: %v, got: %v", raw, expected, got)
+		}
+	}
+	if got := gojq.Compare(json.RawMessage(`{"a": [1, 2]}`), map[string]any{"a": []any{1, 2}}); got != 0 {
+		t.Errorf("expected: 0, got: %v", got)
+	}
+	if got := gojq.Compare(json.RawMessage(`"b"`), json.RawMessage(`"a"`)); got != 1 {
+		t.Errorf("expected: 1, got: %v", got)
+	}
+}
@@ -1,51 +1,139 @@
 package gojq
 
 import (
+	"bytes"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
 // ModuleLoader is the interface for loading modules.
 //
-// Implement following optional methods. Use [NewModuleLoader] to load local modules.
+// Implement [ModuleQueryLoader], [ModuleJSONLoader], or [InitModuleLoader], or
+// following legacy methods. Use [NewModuleLoader] to load local modules.
 //
-//	LoadInitModules() ([]*Query, error)
 //	LoadModule(string) (*Query, error)
-//	LoadModuleWithMeta(string, map[string]any) (*Query, error)
 //	LoadJSON(string) (any, error)
-//	LoadJSONWithMeta(string, map[string]any) (any, error)
+//
+// When a module is not found, return an error matching [fs.ErrNotExist], so
+// that [ChainModuleLoaders] can look up the module in the next loader.
 type ModuleLoader any
 
+// ModuleQueryLoader is the interface for loading jq modules, which is used on
+// importing or including modules, and by modulemeta function.
+type ModuleQueryLoader interface {
+	LoadModuleWithMeta(string, map[string]any) (*Query, error)
+}
+
+// ModuleJSONLoader is the interface for loading JSON data, which is used on
+// importing data with a variable alias (import "data" as $data).
+type ModuleJSONLoader interface {
+	LoadJSONWithMeta(string, map[string]any) (any, error)
+}
+
+// InitModuleLoader is the interface for loading modules on compilation,
+// which are available in the query without importing.
+type InitModuleLoader interface {
+	LoadInitModules() ([]*Query, error)
+}
+
 // NewModuleLoader creates a new [ModuleLoader] loading local modules in the paths.
 // Note that user can load modules outside the paths using "search" path of metadata.
 // Empty paths are ignored, so specify "." for the current working directory.
-func NewModuleLoader(paths []string) ModuleLoader {
+func NewModuleLoader(paths []string, options ...ModuleLoaderOption) ModuleLoader {
+	l := newModuleLoader(options)
+	l.paths = l.resolvePaths(paths)
+	return l
+}
+
+// NewModuleLoaderFS creates a new [ModuleLoader] loading modules in the paths
+// of the file system. This is useful to load modules embedded in the binary
+// using [embed.FS]. The paths are slash-separated and relative to the root of
+// the file system, and paths starting with "~/" or "$ORIGIN/" are ignored.
+// Specify "." for the root directory.
+func NewModuleLoaderFS(fsys fs.FS, paths []string, options ...ModuleLoaderOption) ModuleLoader {
+	l := newModuleLoader(options)
+	l.fsys = fsys
+	l.paths = l.resolvePaths(paths)
+	return l
+}
+
+// ModuleLoaderOption is an option for the module loaders created by
+// [NewModuleLoader], [NewModuleLoaderFS], and [NewModuleLoaderWithLock].
+type ModuleLoaderOption func(*moduleLoader)
+
+// WithDataFormat is a module loader option for importing data files of the
+// format (import "data" as $data). The format is detected by the extensions
+// (like ".csv"), or specified by the metadata like {format: "csv"}. The decode
+// function returns the values in the contents of the file. The JSON (".json")
+// and NDJSON (".ndjson") formats are supported by default.
+func WithDataFormat(format string, extensions []string, decode func([]byte) ([]any, error)) ModuleLoaderOption {
+	return func(l *moduleLoader) {
+		l.formats = append(l.formats, dataFormat{format, extensions,
+			func(path string, cnt []byte) (any, error) {
+				vals, err := decode(cnt)
+				if err != nil {
+					return nil, &dataParseError{format, path, string(cnt), err, nil}
+				}
+				if vals == nil {
+					vals = []any{}
+				}
+				return vals, nil
+			},
+		})
+	}
+}
+
+type moduleLoader struct {
+	fsys    fs.FS
+	paths   []string
+	formats []dataFormat
+	lock    *ModuleLock
+	update  bool
+}
+
+type dataFormat struct {
+	name       string
+	extensions []string
+	decode     func(string, []byte) (any, error)
+}
+
+func newModuleLoader(options []ModuleLoaderOption) *moduleLoader {
+	l := &moduleLoader{formats: []dataFormat{
+		{"json", []string{".json"}, decodeJSONData},
+		{"ndjson", []string{".ndjson"}, decodeJSONData},
+	}}
+	for _, opt := range options {
+		opt(l)
+	}
+	return l
+}
+
+func (l *moduleLoader) resolvePaths(paths []string) []string {
 	ps := make([]string, 0, len(paths))
 	for _, path := range paths {
-		if path = resolvePath(path, ""); path != "" {
+		if path = l.resolvePath(path, ""); path != "" {
 			ps = append(ps, path)
 		}
 	}
-	return &moduleLoader{ps}
-}
-
-type moduleLoader struct {
-	paths []string
+	return ps
 }
 
 func (l *moduleLoader) LoadInitModules() ([]*Query, error) {
 	var qs []*Query
 	for _, path := range l.paths {
-		if filepath.Base(path) != ".jq" {
+		if l.base(path) != ".jq" {
 			continue
 		}
-		fi, err := os.Stat(path)
+		fi, err := l.stat(path)
 		if err != nil {
-			if os.IsNotExist(err) {
+			if errors.Is(err, fs.ErrNotExist) {
 				continue
 			}
 			return nil, err
@@ -53,13 +141,16 @@ func (l *moduleLoader) LoadInitModules() ([]*Query, error) {
 		if fi.IsDir() {
 			continue
 		}
-		cnt, err := os.ReadFile(path)
+		cnt, err := l.readFile(path)
 		if err != nil {
 			return nil, err
 		}
-		q, err := parseModule(string(cnt), filepath.Dir(path))
+		if err := l.verifyModule(path, path, path, cnt, nil); err != nil {
+			return nil, err
+		}
+		q, err := l.parseModule(string(cnt), l.dir(path))
 		if err != nil {
-			return nil, &queryParseError{path, string(cnt), err}
+			return nil, &queryParseError{path, string(cnt), err, nil}
 		}
 		qs = append(qs, q)
 	}
@@ -67,33 +158,63 @@ func (l *moduleLoader) LoadInitModules() ([]*Query, error) {
 }
 
 func (l *moduleLoader) LoadModuleWithMeta(name string, meta map[string]any) (*Query, error) {
-	path, err := l.lookupModule(name, ".jq", meta)
+	path, key, err := l.lookupModule(name, []string{".jq"}, meta)
 	if err != nil {
 		return nil, err
 	}
-	cnt, err := os.ReadFile(path)
+	cnt, err := l.readFile(path)
 	if err != nil {
 		return nil, err
 	}
-	q, err := parseModule(string(cnt), filepath.Dir(path))
+	if err := l.verifyModule(name, key, path, cnt, meta); err != nil {
+		return nil, err
+	}
+	q, err := l.parseModule(string(cnt), l.dir(path))
 	if err != nil {
-		return nil, &queryParseError{path, string(cnt), err}
+		return nil, &queryParseError{path, string(cnt), err, nil}
 	}
 	return q, nil
 }
 
 func (l *moduleLoader) LoadJSONWithMeta(name string, meta map[string]any) (any, error) {
-	path, err := l.lookupModule(name, ".json", meta)
+	format, _ := meta["format"].(string)
+	formats := l.formats
+	if format != "" {
+		formats = slices.DeleteFunc(slices.Clone(formats), func(f dataFormat) bool {
+			return f.name != format && !slices.Contains(f.extensions, "."+format)
+		})
+		if len(formats) == 0 {
+			return nil, &dataFormatError{format}
+		}
+	}
+	var extensions []string
+	for _, f := range formats {
+		extensions = append(extensions, f.extensions...)
+	}
+	path, key, err := l.lookupModule(name, extensions, meta)
 	if err != nil {
 		return nil, err
 	}
-	f, err := os.Open(path)
+	cnt, err := l.readFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	if err := l.verifyModule(name, key, path, cnt, meta); err != nil {
+		return nil, err
+	}
+	for _, f := range formats {
+		for _, extension := range f.extensions {
+			if strings.HasSuffix(path, extension) {
+				return f.decode(path, cnt)
+			}
+		}
+	}
+	return decodeJSONData(path, cnt)
+}
+
+func decodeJSONData(path string, cnt []byte) (any, error) {
 	vals := []any{}
-	dec := json.NewDecoder(f)
+	dec := json.NewDecoder(bytes.NewReader(cnt))
 	dec.UseNumber()
 	for {
 		var val any
@@ -101,41 +222,40 @@ func (l *moduleLoader) LoadJSONWithMeta(name string, meta map[string]any) (any,
 			if err == io.EOF {
 				break
 			}
-			if _, err := f.Seek(0, io.SeekStart); err != nil {
-				return nil, err
-			}
-			cnt, er := io.ReadAll(f)
-			if er != nil {
-				return nil, er
-			}
-			return nil, &jsonParseError{path, string(cnt), err}
+			return nil, &jsonParseError{path, string(cnt), err, nil}
 		}
 		vals = append(vals, val)
 	}
 	return vals, nil
 }
 
-func (l *moduleLoader) lookupModule(name, extension string, meta map[string]any) (string, error) {
+// lookupModule returns the path of the module, and the path joining the search
+// path and the module name, which is the key of the module lock.
+func (l *moduleLoader) lookupModule(name string, extensions []string, meta map[string]any) (string, string, error) {
 	paths := l.paths
 	if path, ok := meta["search"].(string); ok {
-		if path = resolvePath(path, ""); path != "" {
+		if path = l.resolvePath(path, ""); path != "" {
 			paths = append([]string{path}, paths...)
 		}
 	}
 	for _, base := range paths {
-		path := filepath.Join(base, name+extension)
-		if _, err := os.Stat(path); err == nil {
-			return path, err
+		for _, extension := range extensions {
+			path := l.join(base, name+extension)
+			if _, err := l.stat(path); err == nil {
+				return path, path, err
+			}
 		}
-		path = filepath.Join(base, name, filepath.Base(name)+extension)
-		if _, err := os.Stat(path); err == nil {
-			return path, err
+		for _, extension := range extensions {
+			path := l.join(base, name, l.base(name)+extension)
+			if _, err := l.stat(path); err == nil {
+				return path, l.join(base, name+extension), err
+			}
 		}
 	}
-	return "", fmt.Errorf("module not found: %q", name)
+	return "", "", &moduleNotFoundError{name}
 }
 
-func parseModule(cnt, dir string) (*Query, error) {
+func (l *moduleLoader) parseModule(cnt, dir string) (*Query, error) {
 	q, err := Parse(cnt)
 	if err != nil {
 		return nil, err
@@ -145,7 +265,7 @@ func parseModule(cnt, dir string) (*Query, error) {
 			for _, e := range i.Meta.KeyVals {
 				if e.Key == "search" || e.KeyString == "search" {
 					if path, ok := e.Val.toString(); ok {
-						if path = resolvePath(path, dir); path != "" {
+						if path = l.resolvePath(path, dir); path != "" {
 							e.Val.Str = path
 						} else {
 							e.Val.Null = true
@@ -158,7 +278,10 @@ func parseModule(cnt, dir string) (*Query, error) {
 	return q, nil
 }
 
-func resolvePath(path, dir string) string {
+func (l *moduleLoader) resolvePath(path, dir string) string {
+	if l.fsys != nil {
+		return resolvePathFS(path, dir)
+	}
 	switch {
 	case filepath.IsAbs(path):
 		return path
@@ -182,3 +305,56 @@ func resolvePath(path, dir string) string {
 		return filepath.Join(dir, path)
 	}
 }
+
+func resolvePathFS(p, dir string) string {
+	switch {
+	case strings.HasPrefix(p, "~/"), strings.HasPrefix(p, "$ORIGIN/"):
+		return ""
+	case path.IsAbs(p):
+		p = path.Clean(p)[1:]
+		if p == "" {
+			p = "."
+		}
+	default:
+		p = path.Join(dir, p)
+	}
+	if !fs.ValidPath(p) {
+		return ""
+	}
+	return p
+}
+
+func (l *moduleLoader) stat(path string) (fs.FileInfo, error) {
+	if l.fsys != nil {
+		return fs.Stat(l.fsys, path)
+	}
+	return os.Stat(path)
+}
+
+func (l *moduleLoader) readFile(path string) ([]byte, error) {
+	if l.fsys != nil {
+		return fs.ReadFile(l.fsys, path)
+	}
+	return os.ReadFile(path)
+}
+
+func (l *moduleLoader) join(elem ...string) string {
+	if l.fsys != nil {
+		return path.Join(elem...)
+	}
+	return filepath.Join(elem...)
+}
+
+func (l *moduleLoader) dir(p string) string {
+	if l.fsys != nil {
+		return path.Dir(p)
+	}
+	return filepath.Dir(p)
+}
+
+func (l *moduleLoader) base(p string) string {
+	if l.fsys != nil {
+		return path.Base(p)
+	}
+	return filepath.Base(p)
+}
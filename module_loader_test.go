@@ -0,0 +1,203 @@
+package gojq_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/itchyny/gojq"
+)
+
+func ExampleNewModuleLoaderFS() {
+	fsys := fstest.MapFS{
+		"lib/util.jq": {Data: []byte(`def double: . * 2;`)},
+	}
+	query, err := gojq.Parse(`import "util" as u; .[] | u::double`)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	code, err := gojq.Compile(
+		query,
+		gojq.WithModuleLoader(gojq.NewModuleLoaderFS(fsys, []string{"lib"})),
+	)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	iter := code.Run([]any{1, 2, 3})
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			log.Fatalln(err)
+		}
+		fmt.Printf("%#v\n", v)
+	}
+
+	// Output:
+	// 2
+	// 4
+	// 6
+}
+
+func decodeLines(cnt []byte) ([]any, error) {
+	var vals []any
+	for _, line := range strings.SplitAfter(string(cnt), "\n") {
+		if line == "\n" {
+			return nil, errors.New("empty line")
+		} else if line != "" {
+			vals = append(vals, strings.TrimSuffix(line, "\n"))
+		}
+	}
+	return vals, nil
+}
+
+func TestNewModuleLoaderFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/.jq":           {Data: []byte(`def init: "init";`)},
+		"lib/m1.jq":         {Data: []byte(`import "m2" as m2 {search: "sub"}; def f: m2::g;`)},
+		"lib/sub/m2.jq":     {Data: []byte(`def g: "m2";`)},
+		"lib/m3/m3.jq":      {Data: []byte(`import "data" as $d {search: "/data"}; def h: $d;`)},
+		"data/data.json":    {Data: []byte(`{"foo": 1} [2]`)},
+		"data/data.txt":     {Data: []byte("foo\nbar\n")},
+		"lib/invalid.txt":   {Data: []byte("\n")},
+		"lib/invalid.jq":    {Data: []byte(`def f: ;`)},
+		"lib/invalid.json":  {Data: []byte(`{`)},
+		"lib/parent/m4.jq":  {Data: []byte(`import "m1" as m1 {search: ".."}; def f: m1::f;`)},
+		"lib/outside/m5.jq": {Data: []byte(`import "m2" as m2 {search: "../../../lib/sub"}; def f: m2::g;`)},
+	}
+	testCases := []struct {
+		name     string
+		src      string
+		expected []any
+		err      string
+	}{
+		{
+			name:     "init module",
+			src:      `init`,
+			expected: []any{"init"},
+		},
+		{
+			name:     "search metadata",
+			src:      `import "m1" as m1; m1::f`,
+			expected: []any{"m2"},
+		},
+		{
+			name:     "directory layout and data",
+			src:      `import "m3" as m3; m3::h`,
+			expected: []any{[]any{map[string]any{"foo": json.Number("1")}, []any{json.Number("2")}}},
+		},
+		{
+			name:     "data import",
+			src:      `import "data" as $d {search: "data"}; $d::d[1]`,
+			expected: []any{[]any{json.Number("2")}},
+		},
+		{
+			name:     "custom data format",
+			src:      `import "data" as $d {search: "data", format: "lines"}; $d`,
+			expected: []any{[]any{"foo", "bar"}},
+		},
+		{
+			name: "unsupported data format",
+			src:  `import "data" as $d {search: "data", format: "csv"}; $d`,
+			err:  `unsupported data format: "csv" (import chain: "data")`,
+		},
+		{
+			name:     "search parent directory",
+			src:      `import "parent/m4" as m4; m4::f`,
+			expected: []any{"m2"},
+		},
+		{
+			name: "search outside file system",
+			src:  `import "outside/m5" as m5; m5::f`,
+			err:  `module not found: "m2" (import chain: "outside/m5")`,
+		},
+		{
+			name: "module not found",
+			src:  `import "m0" as m0; m0::f`,
+			err:  `module not found: "m0"`,
+		},
+		{
+			name: "invalid module",
+			src:  `import "invalid" as m; .`,
+			err:  `invalid query: lib/invalid.jq: unexpected token ";" (import chain: "invalid")`,
+		},
+		{
+			name: "invalid json",
+			src:  `import "invalid" as $m; .`,
+			err:  `invalid json: lib/invalid.json: unexpected EOF (import chain: "invalid")`,
+		},
+		{
+			name: "invalid custom data format",
+			src:  `import "invalid" as $m {format: "txt"}; .`,
+			err:  `invalid lines: lib/invalid.txt: empty line (import chain: "invalid")`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := gojq.Parse(tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := gojq.Compile(query,
+				gojq.WithModuleLoader(gojq.NewModuleLoaderFS(fsys, []string{"lib/.jq", "lib"},
+					gojq.WithDataFormat("lines", []string{".txt"}, decodeLines))))
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected: %v, got: %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []any
+			iter := code.Run(nil)
+			for {
+				v, ok := iter.Next()
+				if !ok {
+					break
+				}
+				if err, ok := v.(error); ok {
+					t.Fatal(err)
+				}
+				got = append(got, v)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected: %v, got: %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewModuleLoaderFSParseErrorType(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m1.jq":      {Data: []byte(`import "invalid" as m; def f: m::f;`)},
+		"invalid.jq": {Data: []byte(`def f: ;`)},
+	}
+	query, err := gojq.Parse(`import "m1" as m1; m1::f`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = gojq.Compile(query,
+		gojq.WithModuleLoader(gojq.NewModuleLoaderFS(fsys, []string{"."})))
+	e, ok := err.(interface {
+		QueryParseError() (string, string, error)
+		ImportChain() string
+	})
+	if !ok {
+		t.Fatalf("expected a query parse error but got: %#v", err)
+	}
+	if fname, _, _ := e.QueryParseError(); fname != "invalid.jq" {
+		t.Errorf("expected: %v, got: %v", "invalid.jq", fname)
+	}
+	if got, expected := e.ImportChain(), `"m1" -> "invalid"`; got != expected {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+}
@@ -0,0 +1,256 @@
+package gojq
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+func toModuleQueryLoader(l ModuleLoader) ModuleQueryLoader {
+	switch l := l.(type) {
+	case ModuleQueryLoader:
+		return l
+	case interface{ LoadModule(string) (*Query, error) }:
+		return moduleQueryLoaderFunc(func(name string, _ map[string]any) (*Query, error) {
+			return l.LoadModule(name)
+		})
+	default:
+		return nil
+	}
+}
+
+func toModuleJSONLoader(l ModuleLoader) ModuleJSONLoader {
+	switch l := l.(type) {
+	case ModuleJSONLoader:
+		return l
+	case interface{ LoadJSON(string) (any, error) }:
+		return moduleJSONLoaderFunc(func(name string, _ map[string]any) (any, error) {
+			return l.LoadJSON(name)
+		})
+	default:
+		return nil
+	}
+}
+
+func isModuleLoader(l ModuleLoader) bool {
+	if _, ok := l.(InitModuleLoader); ok {
+		return true
+	}
+	return toModuleQueryLoader(l) != nil || toModuleJSONLoader(l) != nil
+}
+
+var moduleLoaderMethods = []struct {
+	name string
+	typ  reflect.Type
+}{
+	{"LoadInitModules", reflect.TypeFor[InitModuleLoader]()},
+	{"LoadModuleWithMeta", reflect.TypeFor[ModuleQueryLoader]()},
+	{"LoadJSONWithMeta", reflect.TypeFor[ModuleJSONLoader]()},
+	{"LoadModule", reflect.TypeFor[interface{ LoadModule(string) (*Query, error) }]()},
+	{"LoadJSON", reflect.TypeFor[interface{ LoadJSON(string) (any, error) }]()},
+}
+
+// checkModuleLoader returns an error when the loader implements none of the
+// loading methods, or a method of the names with an unexpected signature. The
+// loaders combined by the functions in this file are checked recursively.
+func checkModuleLoader(l ModuleLoader) error {
+	switch l := l.(type) {
+	case nil:
+		return &invalidModuleLoaderError{"<nil>", ""}
+	case *chainModuleLoader:
+		for _, l := range l.loaders {
+			if err := checkModuleLoader(l); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *mountModuleLoader:
+		return checkModuleLoader(l.loader)
+	case *cachingModuleLoader:
+		return checkModuleLoader(l.loader)
+	}
+	t := reflect.TypeOf(l)
+	for _, m := range moduleLoaderMethods {
+		if _, ok := t.MethodByName(m.name); ok && !t.Implements(m.typ) {
+			return &invalidModuleLoaderError{t.String(), m.name}
+		}
+	}
+	if !isModuleLoader(l) {
+		return &invalidModuleLoaderError{t.String(), ""}
+	}
+	return nil
+}
+
+type moduleQueryLoaderFunc func(string, map[string]any) (*Query, error)
+
+func (f moduleQueryLoaderFunc) LoadModuleWithMeta(name string, meta map[string]any) (*Query, error) {
+	return f(name, meta)
+}
+
+type moduleJSONLoaderFunc func(string, map[string]any) (any, error)
+
+func (f moduleJSONLoaderFunc) LoadJSONWithMeta(name string, meta map[string]any) (any, error) {
+	return f(name, meta)
+}
+
+// ChainModuleLoaders creates a new [ModuleLoader] looking up modules in the
+// loaders in order, so the former loaders take precedence over the latter.
+// When a loader does not implement the loading method, or returns an error
+// matching [fs.ErrNotExist], the module is looked up in the next loader. The
+// init modules of all the loaders are loaded in order.
+func ChainModuleLoaders(loaders ...ModuleLoader) ModuleLoader {
+	return &chainModuleLoader{loaders}
+}
+
+type chainModuleLoader struct {
+	loaders []ModuleLoader
+}
+
+func (l *chainModuleLoader) LoadInitModules() ([]*Query, error) {
+	var qs []*Query
+	for _, l := range l.loaders {
+		if l, ok := l.(InitModuleLoader); ok {
+			xs, err := l.LoadInitModules()
+			if err != nil {
+				return nil, err
+			}
+			qs = append(qs, xs...)
+		}
+	}
+	return qs, nil
+}
+
+func (l *chainModuleLoader) LoadModuleWithMeta(name string, meta map[string]any) (*Query, error) {
+	for _, l := range l.loaders {
+		if l := toModuleQueryLoader(l); l != nil {
+			q, err := l.LoadModuleWithMeta(name, meta)
+			if err == nil || !errors.Is(err, fs.ErrNotExist) {
+				return q, err
+			}
+		}
+	}
+	return nil, &moduleNotFoundError{name}
+}
+
+func (l *chainModuleLoader) LoadJSONWithMeta(name string, meta map[string]any) (any, error) {
+	for _, l := range l.loaders {
+		if l := toModuleJSONLoader(l); l != nil {
+			v, err := l.LoadJSONWithMeta(name, meta)
+			if err == nil || !errors.Is(err, fs.ErrNotExist) {
+				return v, err
+			}
+		}
+	}
+	return nil, &moduleNotFoundError{name}
+}
+
+// MountModuleLoader creates a new [ModuleLoader] loading the modules under the
+// prefix using the loader. For example, when the prefix is "company", the
+// module "company/util" is loaded as "util" by the loader. Other modules are
+// not found, and the init modules of the loader are not loaded. Use this with
+// [ChainModuleLoaders] to combine multiple sources of modules.
+func MountModuleLoader(prefix string, loader ModuleLoader) ModuleLoader {
+	return &mountModuleLoader{strings.TrimSuffix(prefix, "/") + "/", loader}
+}
+
+type mountModuleLoader struct {
+	prefix string
+	loader ModuleLoader
+}
+
+func (l *mountModuleLoader) LoadModuleWithMeta(name string, meta map[string]any) (*Query, error) {
+	if s, ok := strings.CutPrefix(name, l.prefix); ok {
+		if loader := toModuleQueryLoader(l.loader); loader != nil {
+			return loader.LoadModuleWithMeta(s, meta)
+		}
+	}
+	return nil, &moduleNotFoundError{name}
+}
+
+func (l *mountModuleLoader) LoadJSONWithMeta(name string, meta map[string]any) (any, error) {
+	if s, ok := strings.CutPrefix(name, l.prefix); ok {
+		if loader := toModuleJSONLoader(l.loader); loader != nil {
+			return loader.LoadJSONWithMeta(s, meta)
+		}
+	}
+	return nil, &moduleNotFoundError{name}
+}
+
+// NewCachingModuleLoader creates a new [ModuleLoader] caching the modules and
+// JSON data loaded by the loader, so that each module is loaded and parsed at
+// most once. The modules are keyed by the name and the metadata. Errors are
+// not cached. The loader is safe for concurrent use by multiple goroutines,
+// so share the loader across compilations to avoid parsing the same modules.
+func NewCachingModuleLoader(loader ModuleLoader) ModuleLoader {
+	return &cachingModuleLoader{loader: loader, values: make(map[string]any)}
+}
+
+type cachingModuleLoader struct {
+	loader ModuleLoader
+	mu     sync.Mutex
+	inits  []*Query
+	values map[string]any
+}
+
+func (l *cachingModuleLoader) LoadInitModules() ([]*Query, error) {
+	loader, ok := l.loader.(InitModuleLoader)
+	if !ok {
+		return nil, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inits == nil {
+		qs, err := loader.LoadInitModules()
+		if err != nil {
+			return nil, err
+		}
+		l.inits = append(make([]*Query, 0, len(qs)), qs...)
+	}
+	return l.inits, nil
+}
+
+func (l *cachingModuleLoader) LoadModuleWithMeta(name string, meta map[string]any) (*Query, error) {
+	loader := toModuleQueryLoader(l.loader)
+	if loader == nil {
+		return nil, &moduleNotFoundError{name}
+	}
+	v, err := l.load("module\x00"+name, meta, func() (any, error) {
+		return loader.LoadModuleWithMeta(name, meta)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Query), nil
+}
+
+func (l *cachingModuleLoader) LoadJSONWithMeta(name string, meta map[string]any) (any, error) {
+	loader := toModuleJSONLoader(l.loader)
+	if loader == nil {
+		return nil, &moduleNotFoundError{name}
+	}
+	return l.load("json\x00"+name, meta, func() (any, error) {
+		return loader.LoadJSONWithMeta(name, meta)
+	})
+}
+
+func (l *cachingModuleLoader) load(key string, meta map[string]any, f func() (any, error)) (any, error) {
+	bs, err := json.Marshal(meta)
+	if err != nil {
+		return f()
+	}
+	key += "\x00" + string(bs)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if v, ok := l.values[key]; ok {
+		return v, nil
+	}
+	v, err := f()
+	if err != nil {
+		return nil, err
+	}
+	l.values[key] = v
+	return v, nil
+}
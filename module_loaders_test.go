@@ -0,0 +1,253 @@
+package gojq_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/itchyny/gojq"
+)
+
+func ExampleChainModuleLoaders() {
+	defaults := fstest.MapFS{
+		"greet.jq":    {Data: []byte(`def greet: "Hello, \(.)!";`)},
+		"farewell.jq": {Data: []byte(`def farewell: "Goodbye, \(.)!";`)},
+	}
+	overrides := fstest.MapFS{
+		"greet.jq": {Data: []byte(`def greet: "Hi, \(.)!";`)},
+	}
+	company := fstest.MapFS{
+		"util.jq": {Data: []byte(`def shout: ascii_upcase;`)},
+	}
+	query, err := gojq.Parse(`
+		import "greet" as g;
+		import "farewell" as f;
+		import "company/util" as u;
+		g::greet, f::farewell, u::shout
+	`)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	code, err := gojq.Compile(
+		query,
+		gojq.WithModuleLoader(gojq.ChainModuleLoaders(
+			gojq.NewModuleLoaderFS(overrides, []string{"."}),
+			gojq.NewModuleLoaderFS(defaults, []string{"."}),
+			gojq.MountModuleLoader("company", gojq.NewModuleLoaderFS(company, []string{"."})),
+		)),
+	)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	iter := code.Run("gojq")
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			log.Fatalln(err)
+		}
+		fmt.Printf("%#v\n", v)
+	}
+
+	// Output:
+	// "Hi, gojq!"
+	// "Goodbye, gojq!"
+	// "GOJQ"
+}
+
+func TestChainModuleLoaders(t *testing.T) {
+	loader := gojq.ChainModuleLoaders(
+		gojq.MountModuleLoader("m", gojq.NewModuleLoaderFS(fstest.MapFS{
+			"data.json":  {Data: []byte(`1`)},
+			"invalid.jq": {Data: []byte(`def f: ;`)},
+		}, []string{"."})),
+		gojq.NewModuleLoaderFS(fstest.MapFS{
+			".jq":        {Data: []byte(`def init: "init1";`)},
+			"data.json":  {Data: []byte(`2`)},
+			"invalid.jq": {Data: []byte(`def f: 1;`)},
+		}, []string{".jq", "."}),
+		&moduleLoader{},
+	)
+	testCases := []struct {
+		src      string
+		expected []any
+		err      string
+	}{
+		{
+			src:      `init`,
+			expected: []any{"init1"},
+		},
+		{
+			src:      `import "m/data" as $d; $d[0]`,
+			expected: []any{json.Number("1")},
+		},
+		{
+			src:      `import "data" as $d; $d[0]`,
+			expected: []any{json.Number("2")},
+		},
+		{
+			src:      `import "module2" as m; {foo: 3} | m::f`,
+			expected: []any{3},
+		},
+		{
+			src:      `import "invalid" as m; m::f`,
+			expected: []any{1},
+		},
+		{
+			src: `import "m/invalid" as m; m::f`,
+			err: `invalid query: invalid.jq: unexpected token ";" (import chain: "m/invalid")`,
+		},
+		{
+			src: `import "m/module2" as m; m::f`,
+			err: `module not found: "m/module2" (import chain: "m/module2")`,
+		},
+		{
+			src: `import "module1" as m; import "module2" as $m; m::g`,
+			err: `module not found: "module2"`,
+		},
+		{
+			src: `import "module0" as $m; $m`,
+			err: `module not found: "module0"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.src, func(t *testing.T) {
+			query, err := gojq.Parse(tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := gojq.Compile(query, gojq.WithModuleLoader(loader))
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected: %v, got: %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []any
+			iter := code.Run(nil)
+			for {
+				v, ok := iter.Next()
+				if !ok {
+					break
+				}
+				if err, ok := v.(error); ok {
+					t.Fatal(err)
+				}
+				got = append(got, v)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected: %v, got: %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestModuleNotFoundError(t *testing.T) {
+	loader := gojq.NewModuleLoaderFS(fstest.MapFS{}, []string{"."})
+	_, err := loader.(gojq.ModuleQueryLoader).LoadModuleWithMeta("m", nil)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected: %v, got: %v", fs.ErrNotExist, err)
+	}
+}
+
+type countingModuleLoader struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (l *countingModuleLoader) LoadModuleWithMeta(name string, meta map[string]any) (*gojq.Query, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	return gojq.Parse(fmt.Sprintf(`def f: %q;`, name))
+}
+
+func TestNewCachingModuleLoader(t *testing.T) {
+	counter := &countingModuleLoader{}
+	loader := gojq.NewCachingModuleLoader(counter)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			query, err := gojq.Parse(`import "m1" as m1; import "m2" as m2; m1::f + m2::f`)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			code, err := gojq.Compile(query, gojq.WithModuleLoader(loader))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if v, _ := code.Run(nil).Next(); v != "m1m2" {
+				t.Errorf("expected: %v, got: %v", "m1m2", v)
+			}
+		}()
+	}
+	wg.Wait()
+	if expected := 2; counter.count != expected {
+		t.Errorf("expected: %v, got: %v", expected, counter.count)
+	}
+	query, err := gojq.Parse(`import "m1" as m1 {search: "."}; m1::f`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gojq.Compile(query, gojq.WithModuleLoader(loader)); err != nil {
+		t.Fatal(err)
+	}
+	if expected := 3; counter.count != expected {
+		t.Errorf("expected: %v, got: %v", expected, counter.count)
+	}
+}
+
+func TestWithModuleLoaderInvalid(t *testing.T) {
+	query, err := gojq.Parse(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		loader   gojq.ModuleLoader
+		expected string
+	}{
+		{
+			struct{}{},
+			"invalid module loader: struct {}",
+		},
+		{
+			&invalidModuleLoader{},
+			"invalid module loader: *gojq_test.invalidModuleLoader: unexpected signature of LoadModule method",
+		},
+		{
+			gojq.NewCachingModuleLoader(gojq.ChainModuleLoaders(
+				gojq.NewModuleLoader(nil), gojq.MountModuleLoader("x", &invalidModuleLoader{}),
+			)),
+			"invalid module loader: *gojq_test.invalidModuleLoader: unexpected signature of LoadModule method",
+		},
+	} {
+		_, err := gojq.Compile(query, gojq.WithModuleLoader(tc.loader))
+		if err == nil {
+			t.Fatalf("expected an error for %T", tc.loader)
+		}
+		if got := err.Error(); got != tc.expected {
+			t.Errorf("expected: %v, got: %v", tc.expected, got)
+		}
+	}
+}
+
+type invalidModuleLoader struct{}
+
+func (*invalidModuleLoader) LoadModule(string) (gojq.Query, error) {
+	return gojq.Query{}, nil
+}
@@ -0,0 +1,87 @@
+package gojq
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"sync"
+)
+
+// ModuleLock is the lock of module files, which pins the paths and the SHA-256
+// checksums of the modules. The keys of Modules are the module names joined to
+// the search paths with the file extensions, like "lib.jq" and "lib/data.json".
+// The keys and the paths of the entries are slash-separated and relative to
+// Dir, which should be the directory of the lockfile (defaults to the current
+// directory), so that the lockfile works regardless of the working directory.
+// Use [encoding/json] to read and write the lockfile. Refer to
+// [NewModuleLoaderWithLock] for the usage.
+type ModuleLock struct {
+	Modules map[string]*ModuleLockEntry `json:"modules"`
+	Dir     string                      `json:"-"`
+	mu      sync.Mutex
+}
+
+// ModuleLockEntry is an entry of [ModuleLock].
+type ModuleLockEntry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// NewModuleLoaderWithLock creates a new [ModuleLoader] loading local modules
+// in the paths like [NewModuleLoader], and verifies the paths and checksums of
+// the modules against the lock. Loading modules not in the lock results in an
+// error. When update is true, the loader records the loaded modules to the
+// lock instead of verifying them. The init modules are verified as well.
+func NewModuleLoaderWithLock(paths []string, lock *ModuleLock, update bool, options ...ModuleLoaderOption) ModuleLoader {
+	l := newModuleLoader(options)
+	l.lock, l.update = lock, update
+	l.paths = l.resolvePaths(paths)
+	return l
+}
+
+func (l *moduleLoader) verifyModule(name, key, path string, cnt []byte, meta map[string]any) error {
+	sum := sha256.Sum256(cnt)
+	checksum := hex.EncodeToString(sum[:])
+	if s, ok := meta["sha256"].(string); ok && s != checksum {
+		return &moduleChecksumError{name, path, s, checksum}
+	}
+	if l.lock == nil {
+		return nil
+	}
+	l.lock.mu.Lock()
+	defer l.lock.mu.Unlock()
+	key, lockPath := l.lockPath(key), l.lockPath(path)
+	if l.update {
+		if l.lock.Modules == nil {
+			l.lock.Modules = make(map[string]*ModuleLockEntry)
+		}
+		l.lock.Modules[key] = &ModuleLockEntry{lockPath, checksum}
+		return nil
+	}
+	e, ok := l.lock.Modules[key]
+	if !ok {
+		return &moduleNotLockedError{key}
+	}
+	if e.Path != lockPath {
+		return &modulePathMismatchError{key, e.Path, lockPath}
+	}
+	if e.SHA256 != checksum {
+		return &moduleChecksumError{name, path, e.SHA256, checksum}
+	}
+	return nil
+}
+
+func (l *moduleLoader) lockPath(path string) string {
+	dir := l.lock.Dir
+	if dir == "" {
+		dir = "."
+	}
+	if dir, err := filepath.Abs(dir); err == nil {
+		if path, err := filepath.Abs(path); err == nil {
+			if rel, err := filepath.Rel(dir, path); err == nil {
+				return filepath.ToSlash(rel)
+			}
+		}
+	}
+	return filepath.ToSlash(path)
+}
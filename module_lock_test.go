@@ -0,0 +1,104 @@
+package gojq_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func TestNewModuleLoaderWithLock(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lib.jq"), []byte(`def f: 1;`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data.json"), []byte(`[2]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	query, err := gojq.Parse(`import "lib" as lib; import "data" as $data; lib::f, $data`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compile := func(lock *gojq.ModuleLock, update bool) error {
+		_, err := gojq.Compile(query, gojq.WithModuleLoader(
+			gojq.NewModuleLoaderWithLock([]string{dir}, lock, update)))
+		return err
+	}
+	lock := gojq.ModuleLock{Dir: dir}
+	if err := compile(&lock, false); err == nil ||
+		err.Error() != `module not found in lockfile: "lib.jq" (import chain: "lib")` {
+		t.Fatalf("expected: module not found in lockfile, got: %v", err)
+	}
+	if err := compile(&lock, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := len(lock.Modules), 2; got != expected {
+		t.Fatalf("expected: %v, got: %v", expected, got)
+	}
+	if got, expected := lock.Modules["lib.jq"].Path, "lib.jq"; got != expected {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+	if err := compile(&lock, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lib.jq"), []byte(`def f: 2;`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := compile(&lock, false); err == nil ||
+		!strings.HasPrefix(err.Error(), `checksum mismatch of module "lib"`) {
+		t.Fatalf("expected: checksum mismatch, got: %v", err)
+	}
+}
+
+func TestNewModuleLoaderWithLockSameName(t *testing.T) {
+	dir := t.TempDir()
+	for name, cnt := range map[string]string{
+		".jq":      `def h: 0;`,
+		"a/lib.jq": `import "lib" as lib {search: "../b"}; def f: lib::f + 1;`,
+		"b/lib.jq": `def f: 1;`,
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(cnt), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query, err := gojq.Parse(`import "lib" as lib; lib::f, h`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compile := func(lock *gojq.ModuleLock, update bool) error {
+		_, err := gojq.Compile(query, gojq.WithModuleLoader(
+			gojq.NewModuleLoaderWithLock([]string{
+				filepath.Join(dir, ".jq"), filepath.Join(dir, "a"),
+			}, lock, update)))
+		return err
+	}
+	lock := gojq.ModuleLock{Dir: dir}
+	if err := compile(&lock, true); err != nil {
+		t.Fatal(err)
+	}
+	for key, path := range map[string]string{
+		".jq": ".jq", "a/lib.jq": "a/lib.jq", "b/lib.jq": "b/lib.jq",
+	} {
+		if e := lock.Modules[key]; e == nil || e.Path != path {
+			t.Errorf("expected: %v, got: %v", path, e)
+		}
+	}
+	if got, expected := len(lock.Modules), 3; got != expected {
+		t.Fatalf("expected: %v, got: %v", expected, got)
+	}
+	if err := compile(&lock, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".jq"), []byte(`def h: 1;`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := compile(&lock, false); err == nil ||
+		!strings.HasPrefix(err.Error(), "checksum mismatch of module ") {
+		t.Fatalf("expected: checksum mismatch, got: %v", err)
+	}
+}
@@ -1,12 +1,19 @@
 package gojq
 
-import "fmt"
+import (
+	"fmt"
+	"math/rand/v2"
+)
 
 // CompilerOption is a compiler option.
 type CompilerOption func(*compiler)
 
 // WithModuleLoader is a compiler option for module loader.
 // If you want to load modules from the filesystem, use [NewModuleLoader].
+// The module loader should implement at least one of [ModuleQueryLoader],
+// [ModuleJSONLoader], [InitModuleLoader], or the legacy methods described
+// in [ModuleLoader], otherwise [Compile] returns an error. It also returns an
+// error when a method of these names has an unexpected signature.
 func WithModuleLoader(moduleLoader ModuleLoader) CompilerOption {
 	return func(c *compiler) {
 		c.moduleLoader = moduleLoader
@@ -88,9 +95,33 @@ func withFunction(name string, minarity, maxarity int, iter bool, f func(any, []
 // Note that input and inputs functions are not allowed by default. We have
 // to distinguish the query input and the values for input(s) functions. For
 // example, consider using inputs with --null-input. If you want to allow
-// input(s) functions, create an [Iter] and use WithInputIter option.
+// input(s) functions, create an [Iter] and use WithInputIter option. When the
+// iterator implements [InputMetadataIter], input_filename, input_line_number,
+// and input_offset functions return the metadata of the last read value,
+// unless these functions are overridden by [WithFunction].
 func WithInputIter(inputIter Iter) CompilerOption {
 	return func(c *compiler) {
 		c.inputIter = inputIter
 	}
 }
+
+// WithRandSource is a compiler option for the source of random numbers used by
+// random, random_int, shuffle, sample, and uuid4 functions. Specify a seeded
+// source like [rand.NewPCG] to get reproducible results. The source is guarded
+// by a mutex so the compiled code can be run in goroutines. If this option is
+// not specified, each compiled code uses a randomly seeded source.
+func WithRandSource(source rand.Source) CompilerOption {
+	return func(c *compiler) {
+		c.randSource = source
+	}
+}
+
+// WithRegexpEngine is a compiler option for the regular expression engine used
+// by test, match, capture, scan, splits, split, sub, and gsub functions. If this
+// option is not specified, the bundled engine compatible with Oniguruma is used
+// (see [NewRegexpEngine]).
+func WithRegexpEngine(engine RegexpEngine) CompilerOption {
+	return func(c *compiler) {
+		c.regexpEngine = engine
+	}
+}
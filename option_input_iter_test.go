@@ -3,6 +3,8 @@ package gojq_test
 import (
 	"fmt"
 	"log"
+	"reflect"
+	"testing"
 
 	"github.com/itchyny/gojq"
 )
@@ -34,3 +36,71 @@ func ExampleWithInputIter() {
 	// Output:
 	// 15
 }
+
+type lineIter struct {
+	lines []string
+	line  int
+}
+
+func (iter *lineIter) Next() (any, bool) {
+	if iter.line >= len(iter.lines) {
+		return nil, false
+	}
+	iter.line++
+	return iter.lines[iter.line-1], true
+}
+
+func (iter *lineIter) InputMetadata() gojq.InputMetadata {
+	if iter.line == 0 {
+		return gojq.InputMetadata{Offset: -1}
+	}
+	return gojq.InputMetadata{Filename: "test.txt", Offset: -1, Line: iter.line}
+}
+
+func TestWithInputIterMetadata(t *testing.T) {
+	query, err := gojq.Parse(
+		"[input_filename, input_line_number, input_offset], " +
+			"(inputs | [., input_filename, input_line_number, input_offset])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(
+		query,
+		gojq.WithInputIter(&lineIter{lines: []string{"a", "b"}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collectValues(code.Run(nil))
+	expected := []any{
+		[]any{nil, nil, nil},
+		[]any{"a", "test.txt", 1, nil},
+		[]any{"b", "test.txt", 2, nil},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+	code, err = gojq.Compile(query, gojq.WithInputIter(gojq.NewIter(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = collectValues(code.Run(nil))
+	expected = []any{[]any{nil, nil, nil}, []any{1, nil, nil, nil}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+	code, err = gojq.Compile(query,
+		gojq.WithInputIter(&lineIter{lines: []string{"a"}}),
+		gojq.WithFunction("input_filename", 0, 0, func(any, []any) any {
+			return "custom"
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = collectValues(code.Run(nil))
+	expected = []any{[]any{"custom", nil, nil}, []any{"a", "custom", 1, nil}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+}
@@ -0,0 +1,93 @@
+package gojq_test
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func ExampleWithRandSource() {
+	query, err := gojq.Parse("[range(10)] | shuffle")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	code, err := gojq.Compile(
+		query,
+		gojq.WithRandSource(rand.NewPCG(42, 0)),
+	)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	iter := code.Run(nil)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			log.Fatalln(err)
+		}
+		fmt.Printf("%v\n", v)
+	}
+
+	// Output:
+	// [3 2 5 6 4 1 0 7 9 8]
+}
+
+func TestWithRandSourceReproducible(t *testing.T) {
+	query, err := gojq.Parse("random, random_int(0; 1000), uuid4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(seed uint64) []any {
+		code, err := gojq.Compile(query, gojq.WithRandSource(rand.NewPCG(seed, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var xs []any
+		iter := code.Run(nil)
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				t.Fatal(err)
+			}
+			xs = append(xs, v)
+		}
+		return xs
+	}
+	if xs, ys := run(1), run(1); fmt.Sprint(xs) != fmt.Sprint(ys) {
+		t.Errorf("should be reproducible: %v, %v", xs, ys)
+	}
+	if xs, ys := run(1), run(2); fmt.Sprint(xs) == fmt.Sprint(ys) {
+		t.Errorf("should differ with different seeds: %v, %v", xs, ys)
+	}
+}
+
+func TestWithRandSourceGoroutines(t *testing.T) {
+	query, err := gojq.Parse("[range(100) | random_int(0; 10)] | length")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	for range 10 {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			if v, _ := code.Run(nil).Next(); v != 100 {
+				t.Errorf("should emit 100 but got: %v", v)
+			}
+		}()
+	}
+	for range 10 {
+		<-done
+	}
+}
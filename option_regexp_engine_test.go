@@ -0,0 +1,127 @@
+package gojq_test
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+type re2Engine struct{}
+
+func (re2Engine) Compile(pattern, flags string) (gojq.Regexp, error) {
+	if strings.ContainsRune(flags, 'i') {
+		pattern = "(?i)" + pattern
+	}
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re2Regexp{r}, nil
+}
+
+type re2Regexp struct {
+	*regexp.Regexp
+}
+
+func (r re2Regexp) FindAllStringSubmatchIndex(s string, n int) ([][]int, error) {
+	return r.Regexp.FindAllStringSubmatchIndex(s, n), nil
+}
+
+func ExampleWithRegexpEngine() {
+	query, err := gojq.Parse(`[match("(?P<x>a+)b"; "gi") | .captures[0].string]`)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	code, err := gojq.Compile(
+		query,
+		gojq.WithRegexpEngine(re2Engine{}),
+	)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	iter := code.Run("aab AB ab")
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			log.Fatalln(err)
+		}
+		fmt.Printf("%v\n", v)
+	}
+
+	// Output:
+	// [aa A a]
+}
+
+func TestWithRegexpEngineError(t *testing.T) {
+	query, err := gojq.Parse(`test("(?<=a)b")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query, gojq.WithRegexpEngine(re2Engine{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := code.Run("ab").Next()
+	if err, ok := v.(error); !ok {
+		t.Errorf("should emit an error but got: %v", v)
+	} else if expected := "error parsing regexp: invalid named capture: `(?<=a)b`"; err.Error() != expected {
+		t.Errorf("expected: %v, got: %v", expected, err)
+	}
+}
+
+func TestNewRegexpEngineStepLimit(t *testing.T) {
+	query, err := gojq.Parse(`test("(?=a)(a|aa)+$")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query, gojq.WithRegexpEngine(gojq.NewRegexpEngine(1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := code.Run(strings.Repeat("a", 10)).Next(); v != true {
+		t.Errorf("should emit true but got: %v", v)
+	}
+	v, _ := code.Run(strings.Repeat("a", 30) + "b").Next()
+	if err, ok := v.(error); !ok {
+		t.Errorf("should emit an error but got: %v", v)
+	} else if expected := `regular expression "(?=a)(a|aa)+$" exceeded the step limit`; err.Error() != expected {
+		t.Errorf("expected: %v, got: %v", expected, err)
+	}
+}
+
+func TestNewRegexpEngineLongInput(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		input   string
+	}{
+		{"x*z", strings.Repeat("x", 200000)},
+		{"(?=x)x*z", strings.Repeat("x", 200000)},
+		{"(ab)+c", strings.Repeat("ab", 50000)},
+		{"(?=a)(ab)+c", strings.Repeat("ab", 50000)},
+		{"(.*),(.*)", strings.Repeat("x", 5000)},
+		{"(?<!y)(.*),(.*)", strings.Repeat("x", 5000)},
+		{"(?=x)[yz]x*", strings.Repeat("x", 200000)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			query, err := gojq.Parse(`test($pattern)`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := gojq.Compile(query, gojq.WithVariables([]string{"$pattern"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v, _ := code.Run(tc.input, tc.pattern).Next(); v != false {
+				t.Errorf("should emit false but got: %v", v)
+			}
+		})
+	}
+}
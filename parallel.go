@@ -0,0 +1,224 @@
+package gojq
+
+import (
+	"context"
+	"sync"
+)
+
+// RunParallel runs the code against each value emitted by inputs using the
+// given number of goroutines, and returns an iterator emitting the results in
+// the order of the inputs. The evaluation against each input stops at the first
+// error, and an error emitted by inputs is emitted as is at its position. When
+// a [*HaltError] is emitted, the iterator stops reading inputs and ends.
+//
+// If the code uses input or inputs functions, or the number of workers is less
+// than 2, the inputs are processed sequentially in the current goroutine since
+// these functions read the input values in the order. Note that the functions
+// given by [WithFunction] and [WithIterFunction] can be called concurrently.
+// Cancel the context to release the goroutines when you stop the iteration
+// before the iterator ends.
+func (c *Code) RunParallel(ctx context.Context, inputs Iter, workers int, values ...any) Iter {
+	return c.runParallel(ctx, inputs, workers, true, values)
+}
+
+// RunParallelUnordered is like [*Code.RunParallel], but emits the results of
+// each input as soon as the evaluation finishes, regardless of the order of the
+// inputs. This is useful when the order of the results does not matter.
+func (c *Code) RunParallelUnordered(ctx context.Context, inputs Iter, workers int, values ...any) Iter {
+	return c.runParallel(ctx, inputs, workers, false, values)
+}
+
+func (c *Code) runParallel(ctx context.Context, inputs Iter, workers int, ordered bool, values []any) Iter {
+	if workers < 2 || c.usesInput {
+		return &serialIter{ctx: ctx, code: c, inputs: inputs, values: values}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	jobs, results := make(chan *parallelJob), make(chan *parallelJob, workers)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if !job.run(ctx, c.RunWithContext(ctx, job.input, values...), results) {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer func() {
+			close(jobs)
+			wg.Wait()
+			close(results)
+		}()
+		for {
+			v, ok := inputs.Next()
+			if !ok {
+				return
+			}
+			job := &parallelJob{input: v, results: make(chan any, parallelBufferSize)}
+			if _, ok := v.(error); ok {
+				job.results <- v
+				close(job.results)
+			} else {
+				// in the unordered mode, the worker sends the job to the
+				// results when the job finishes or the buffer is full
+				job.pending = !ordered
+				select {
+				case jobs <- job:
+				case <-ctx.Done():
+					return
+				}
+				if !ordered {
+					continue
+				}
+			}
+			select {
+			case results <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return &parallelIter{ctx: ctx, cancel: cancel, results: results}
+}
+
+// parallelBufferSize is the number of the results of each input buffered
+// before the iterator emits them.
+const parallelBufferSize = 64
+
+type parallelJob struct {
+	input   any
+	results chan any
+	pending bool // whether the worker should send the job to the results
+}
+
+// run sends the results of the iterator to the job, stopping at the first
+// error. It returns false when the context is canceled.
+func (job *parallelJob) run(ctx context.Context, iter Iter, results chan<- *parallelJob) bool {
+	defer close(job.results)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		select {
+		case job.results <- v:
+		default:
+			if !job.publish(ctx, results) {
+				return false
+			}
+			select {
+			case job.results <- v:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		if _, ok := v.(error); ok {
+			break
+		}
+	}
+	return job.publish(ctx, results)
+}
+
+func (job *parallelJob) publish(ctx context.Context, results chan<- *parallelJob) bool {
+	if !job.pending {
+		return true
+	}
+	job.pending = false
+	select {
+	case results <- job:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+type parallelIter struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	results chan *parallelJob
+	job     *parallelJob
+}
+
+func (iter *parallelIter) Next() (any, bool) {
+	for iter.results != nil {
+		if iter.job == nil {
+			var ok bool
+			select {
+			case iter.job, ok = <-iter.results:
+			case <-iter.ctx.Done():
+			}
+			if !ok {
+				return iter.end()
+			}
+			continue
+		}
+		select {
+		case v, ok := <-iter.job.results:
+			if !ok {
+				iter.job = nil
+				continue
+			}
+			if _, ok := v.(*HaltError); ok {
+				iter.stop()
+			}
+			return v, true
+		case <-iter.ctx.Done():
+			return iter.end()
+		}
+	}
+	return nil, false
+}
+
+func (iter *parallelIter) end() (any, bool) {
+	err := iter.ctx.Err()
+	iter.stop()
+	if err != nil {
+		return err, true
+	}
+	return nil, false
+}
+
+// stop cancels the workers. Note that this does not wait for the goroutine
+// reading the inputs, which can be blocked until the next input is available.
+func (iter *parallelIter) stop() {
+	iter.cancel()
+	iter.results, iter.job = nil, nil
+}
+
+type serialIter struct {
+	ctx    context.Context
+	code   *Code
+	inputs Iter
+	values []any
+	iter   Iter
+}
+
+func (iter *serialIter) Next() (any, bool) {
+	for iter.inputs != nil {
+		if iter.iter != nil {
+			if v, ok := iter.iter.Next(); ok {
+				if err, ok := v.(error); ok {
+					iter.iter = nil
+					if _, ok := err.(*HaltError); ok {
+						iter.inputs = nil
+					}
+				}
+				return v, true
+			}
+			iter.iter = nil
+		}
+		v, ok := iter.inputs.Next()
+		if !ok {
+			iter.inputs = nil
+			break
+		}
+		if _, ok := v.(error); ok {
+			return v, true
+		}
+		iter.iter = iter.code.RunWithContext(iter.ctx, v, iter.values...)
+	}
+	return nil, false
+}
@@ -0,0 +1,249 @@
+package gojq_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func ExampleCode_RunParallel() {
+	query, err := gojq.Parse(".[] * 2")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	inputs := gojq.NewIter([]any{1, 2}, []any{3}, []any{4, 5, 6})
+	iter := code.RunParallel(context.Background(), inputs, 4)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			log.Fatalln(err)
+		}
+		fmt.Printf("%#v\n", v)
+	}
+
+	// Output:
+	// 2
+	// 4
+	// 6
+	// 8
+	// 10
+	// 12
+}
+
+func collectValues(iter gojq.Iter) []any {
+	var xs []any
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			return xs
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		xs = append(xs, v)
+	}
+}
+
+func TestCodeRunParallel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		inputs   []any
+		workers  int
+		expected []any
+	}{
+		{
+			name:     "ordered",
+			src:      ". + 1, . * 10",
+			inputs:   []any{1, 2, 3, 4, 5},
+			workers:  3,
+			expected: []any{2, 10, 3, 20, 4, 30, 5, 40, 6, 50},
+		},
+		{
+			name:     "error",
+			src:      ". + 1, .",
+			inputs:   []any{1, "x", 3},
+			workers:  2,
+			expected: []any{2, 1, `cannot add: string ("x") and number (1)`, 4, 3},
+		},
+		{
+			name:     "input error",
+			src:      ".",
+			inputs:   []any{1, fmt.Errorf("invalid input"), 3},
+			workers:  2,
+			expected: []any{1, "invalid input", 3},
+		},
+		{
+			name:     "halt",
+			src:      "if . == 3 then halt_error else . end",
+			inputs:   []any{1, 2, 3, 4, 5},
+			workers:  2,
+			expected: []any{1, 2, "halt error: 3"},
+		},
+		{
+			name:     "serial",
+			src:      ". + 1",
+			inputs:   []any{1, 2, 3},
+			workers:  1,
+			expected: []any{2, 3, 4},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := gojq.Parse(tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := gojq.Compile(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := collectValues(code.RunParallel(
+				context.Background(), gojq.NewIter(tc.inputs...), tc.workers))
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected: %v, got: %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCodeRunParallelUnordered(t *testing.T) {
+	query, err := gojq.Parse("[range(.)] | length")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := make([]any, 100)
+	for i := range inputs {
+		inputs[i] = i
+	}
+	got := collectValues(code.RunParallelUnordered(
+		context.Background(), gojq.NewIter(inputs...), 8))
+	seen := make(map[any]bool, len(got))
+	for _, v := range got {
+		seen[v] = true
+	}
+	if len(got) != len(inputs) || len(seen) != len(inputs) {
+		t.Errorf("expected %d distinct values but got: %v", len(inputs), got)
+	}
+}
+
+func TestCodeRunParallelWithInputIter(t *testing.T) {
+	query, err := gojq.Parse("[., input]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := gojq.NewIter(1, 2, 3, 4)
+	code, err := gojq.Compile(query, gojq.WithInputIter(inputs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := collectValues(code.RunParallel(context.Background(), inputs, 4))
+	expected := []any{[]any{1, 2}, []any{3, 4}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+}
+
+func TestCodeRunParallelCancel(t *testing.T) {
+	query, err := gojq.Parse("range(infinite)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	iter := code.RunParallel(ctx, gojq.NewIter(1, 2, 3), 2)
+	cancel()
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			t.Fatal("should emit a context error")
+		}
+		if err, ok := v.(error); ok {
+			if err != context.Canceled {
+				t.Errorf("should emit a context error but got: %v", err)
+			}
+			break
+		}
+	}
+	if v, ok := iter.Next(); ok {
+		t.Errorf("should end after the error but got: %v", v)
+	}
+}
+
+func TestCodeRunParallelInfiniteResults(t *testing.T) {
+	query, err := gojq.Parse("repeat(.)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range []func(context.Context, gojq.Iter, int, ...any) gojq.Iter{
+		code.RunParallel, code.RunParallelUnordered,
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		iter := run(ctx, gojq.NewIter(1, 2), 2)
+		for range 1000 {
+			if v, ok := iter.Next(); !ok {
+				t.Fatal("should emit a value but got no output")
+			} else if v != 1 && v != 2 {
+				t.Fatalf("should emit 1 or 2 but got: %v", v)
+			}
+		}
+		cancel()
+	}
+}
+
+type blockingIter struct {
+	gojq.Iter
+	block chan struct{}
+}
+
+func (iter *blockingIter) Next() (any, bool) {
+	if v, ok := iter.Iter.Next(); ok {
+		return v, true
+	}
+	<-iter.block
+	return nil, false
+}
+
+func TestCodeRunParallelHaltBlockingInputs(t *testing.T) {
+	query, err := gojq.Parse("halt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := &blockingIter{gojq.NewIter(1), make(chan struct{})}
+	defer close(inputs.block)
+	iter := code.RunParallel(context.Background(), inputs, 2)
+	if v, ok := iter.Next(); !ok {
+		t.Fatal("should emit a halt error but got no output")
+	} else if _, ok := v.(*gojq.HaltError); !ok {
+		t.Fatalf("should emit a halt error but got: %v", v)
+	}
+	if v, ok := iter.Next(); ok {
+		t.Errorf("should end after the halt error but got: %v", v)
+	}
+}
@@ -2,6 +2,7 @@ package gojq_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -317,6 +318,35 @@ func TestQueryRun_NonNilSlice(t *testing.T) {
 	}
 }
 
+func TestQueryRun_HashNumbers(t *testing.T) {
+	query, err := gojq.Parse("sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vs := range [][]any{
+		{1, 1.0, json.Number("1.0"), json.RawMessage("1.0")},
+		{1.5, json.Number("1.50"), json.RawMessage(`1.50`)},
+		{100, json.Number("1e2"), json.RawMessage(`1E+2`)},
+		{map[string]any{"a": []any{100}}, map[string]any{"a": []any{json.Number("1e2")}},
+			json.RawMessage(`{"a": [1e2]}`)},
+	} {
+		var hashes []any
+		for _, v := range vs {
+			w, _ := query.Run(v).Next()
+			if err, ok := w.(error); ok {
+				t.Fatal(err)
+			}
+			hashes = append(hashes, w)
+		}
+		for i := 1; i < len(hashes); i++ {
+			if hashes[i] != hashes[0] {
+				t.Errorf("expected the same hashes of %v but got: %v", vs, hashes)
+				break
+			}
+		}
+	}
+}
+
 func TestQueryRun_Race(t *testing.T) {
 	query, err := gojq.Parse("range(10)")
 	if err != nil {
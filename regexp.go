@@ -0,0 +1,824 @@
+package gojq
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RegexpEngine is the interface for regular expression engines, which are used
+// by test, match, capture, scan, splits, split, sub, and gsub functions. The
+// flags are the flags argument of these functions (for example "gi"), so the
+// engine should validate them. The compiled regular expressions are cached by
+// the pattern and flags in each compiled code. The errors are emitted as is.
+type RegexpEngine interface {
+	Compile(pattern, flags string) (Regexp, error)
+}
+
+// Regexp is the interface for compiled regular expressions of [RegexpEngine].
+// The methods should be safe to call in goroutines.
+type Regexp interface {
+	// FindAllStringSubmatchIndex returns the successive matches of the regular
+	// expression, just like [regexp.Regexp.FindAllStringSubmatchIndex]. The
+	// indices are byte offsets of the string, and -1 for unmatched groups. If n
+	// is negative, returns all matches.
+	FindAllStringSubmatchIndex(s string, n int) ([][]int, error)
+	// SubexpNames returns the names of the capturing groups, just like
+	// [regexp.Regexp.SubexpNames]. The name of the first element is always
+	// empty, and the unnamed groups have empty names.
+	SubexpNames() []string
+}
+
+const defaultRegexpStepLimit = 10_000_000
+
+var defaultRegexpEngine = NewRegexpEngine(0)
+
+// NewRegexpEngine returns the bundled regular expression engine, which is used
+// by default. This is a backtracking engine compatible with Oniguruma (the
+// regular expression library used by jq), supporting backreferences, look-ahead
+// and look-behind assertions, atomic groups, and possessive quantifiers. The
+// patterns without these features are matched by the [regexp] package in
+// linear time to the length of the input, interpreted in the same syntax. Along
+// with g (global search), the engine accepts i (ignore case), x (extended
+// syntax), n (ignore empty matches), s (single line mode, which is the default
+// mode), m and p (the dot matches newlines), and l (find longest matches) as
+// the flags. The stepLimit is the maximum number of backtracking steps to find
+// each match; if it is zero, a default limit of 10,000,000 is used.
+func NewRegexpEngine(stepLimit int) RegexpEngine {
+	if stepLimit <= 0 {
+		stepLimit = defaultRegexpStepLimit
+	}
+	return &regexpEngine{stepLimit}
+}
+
+type regexpEngine struct {
+	stepLimit int
+}
+
+func (e *regexpEngine) Compile(pattern, flags string) (Regexp, error) {
+	re := &backtrackRegexp{pattern: pattern, stepLimit: e.stepLimit}
+	var fs regexpFlags
+	for _, f := range flags {
+		switch f {
+		case 'g', 's':
+		case 'i':
+			fs.fold = true
+		case 'x':
+			fs.extended = true
+		case 'm', 'p':
+			fs.dotall = true
+		case 'n':
+			re.notEmpty = true
+		case 'l':
+			re.longest = true
+		default:
+			return nil, fmt.Errorf("unsupported regular expression flag: %q", flags)
+		}
+	}
+	root, names, err := parseRegexp(pattern, fs)
+	if err == nil {
+		c := &regexpCompiler{}
+		if err = c.compile(&regexpNode{op: regexpOpCapture, subs: []*regexpNode{root}}); err == nil {
+			c.emit(regexpInst{op: regexpInstMatch})
+			re.insts, re.regcnt, re.names = c.insts, c.regcnt, names
+			re.prefix, re.literal = regexpPrefix(root), regexpLiteral(root)
+			re.first = regexpFirst(root)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %q: %s", pattern, err)
+	}
+	if l := newLinearRegexp(root, re); l != nil {
+		return l, nil
+	}
+	return re, nil
+}
+
+type regexpInstOp int
+
+const (
+	regexpInstChar regexpInstOp = iota
+	regexpInstAny
+	regexpInstAnyNotNewline
+	regexpInstClass
+	regexpInstSplit
+	regexpInstJump
+	regexpInstSave
+	regexpInstAssert
+	regexpInstBackref
+	regexpInstNullCheckStart
+	regexpInstNullCheckEnd
+	regexpInstLook
+	regexpInstAtomic
+	regexpInstCheckPos
+	regexpInstSucceed
+	regexpInstMatch
+)
+
+type regexpInst struct {
+	op       regexpInstOp
+	r        rune
+	class    *regexpClass
+	fold     bool
+	negate   bool
+	behind   bool
+	x, y     int // jump targets, capture slot, register, assertion kind
+	reg      int // register for look-behind
+	min, max int // width of look-behind
+}
+
+const regexpMaxInsts = 1 << 20
+
+type regexpCompiler struct {
+	insts  []regexpInst
+	regcnt int
+}
+
+func (c *regexpCompiler) emit(inst regexpInst) int {
+	c.insts = append(c.insts, inst)
+	return len(c.insts) - 1
+}
+
+func (c *regexpCompiler) compile(n *regexpNode) error {
+	if len(c.insts) > regexpMaxInsts {
+		return errors.New("too big pattern")
+	}
+	switch n.op {
+	case regexpOpEmpty:
+	case regexpOpLiteral:
+		c.emit(regexpInst{op: regexpInstChar, r: n.r, fold: n.fold})
+	case regexpOpAnyChar:
+		if n.dotall {
+			c.emit(regexpInst{op: regexpInstAny})
+		} else {
+			c.emit(regexpInst{op: regexpInstAnyNotNewline})
+		}
+	case regexpOpClass:
+		c.emit(regexpInst{op: regexpInstClass, class: n.class, fold: n.fold})
+	case regexpOpConcat:
+		for _, n := range n.subs {
+			if err := c.compile(n); err != nil {
+				return err
+			}
+		}
+	case regexpOpAlternate:
+		var jumps []int
+		for i, sub := range n.subs {
+			split := -1
+			if i < len(n.subs)-1 {
+				split = c.emit(regexpInst{op: regexpInstSplit})
+				c.insts[split].x = split + 1
+			}
+			if err := c.compile(sub); err != nil {
+				return err
+			}
+			if split >= 0 {
+				jumps = append(jumps, c.emit(regexpInst{op: regexpInstJump}))
+				c.insts[split].y = len(c.insts)
+			}
+		}
+		for _, i := range jumps {
+			c.insts[i].x = len(c.insts)
+		}
+	case regexpOpCapture:
+		c.emit(regexpInst{op: regexpInstSave, x: n.index * 2})
+		if err := c.compile(n.subs[0]); err != nil {
+			return err
+		}
+		c.emit(regexpInst{op: regexpInstSave, x: n.index*2 + 1})
+	case regexpOpRepeat:
+		return c.compileRepeat(n)
+	case regexpOpAssert:
+		c.emit(regexpInst{op: regexpInstAssert, x: int(n.assert)})
+	case regexpOpBackref:
+		c.emit(regexpInst{op: regexpInstBackref, x: n.index, fold: n.fold})
+	case regexpOpLook:
+		look := c.emit(regexpInst{op: regexpInstLook, x: len(c.insts) + 1,
+			negate: n.negate, behind: n.behind})
+		if n.behind {
+			lo, hi := n.subs[0].width()
+			if hi < 0 {
+				return errors.New("invalid pattern in look-behind")
+			}
+			c.insts[look].min, c.insts[look].max = lo, hi
+			c.insts[look].reg = c.regcnt
+			c.regcnt++
+		}
+		if err := c.compile(n.subs[0]); err != nil {
+			return err
+		}
+		if n.behind {
+			c.emit(regexpInst{op: regexpInstCheckPos, x: c.insts[look].reg})
+		}
+		c.emit(regexpInst{op: regexpInstSucceed})
+		c.insts[look].y = len(c.insts)
+	case regexpOpAtomic:
+		atomic := c.emit(regexpInst{op: regexpInstAtomic, x: len(c.insts) + 1})
+		if err := c.compile(n.subs[0]); err != nil {
+			return err
+		}
+		c.emit(regexpInst{op: regexpInstSucceed})
+		c.insts[atomic].y = len(c.insts)
+	default:
+		panic(fmt.Sprintf("unexpected regexp node: %d", n.op))
+	}
+	return nil
+}
+
+func (c *regexpCompiler) compileRepeat(n *regexpNode) error {
+	if n.possessive {
+		return c.compile(&regexpNode{op: regexpOpAtomic, subs: []*regexpNode{{
+			op: regexpOpRepeat, subs: n.subs, min: n.min, max: n.max,
+		}}})
+	}
+	sub := n.subs[0]
+	for range n.min {
+		if err := c.compile(sub); err != nil {
+			return err
+		}
+	}
+	split := func(i, body, exit int) {
+		if n.lazy {
+			body, exit = exit, body
+		}
+		c.insts[i].x, c.insts[i].y = body, exit
+	}
+	if n.max < 0 {
+		// Exit the loop when the body matches the empty string.
+		loop := c.emit(regexpInst{op: regexpInstSplit})
+		reg := -1
+		if lo, _ := sub.width(); lo == 0 {
+			reg = c.regcnt
+			c.regcnt++
+			c.emit(regexpInst{op: regexpInstNullCheckStart, x: reg})
+		}
+		if err := c.compile(sub); err != nil {
+			return err
+		}
+		check := -1
+		if reg >= 0 {
+			check = c.emit(regexpInst{op: regexpInstNullCheckEnd, x: reg})
+		}
+		c.emit(regexpInst{op: regexpInstJump, x: loop})
+		split(loop, loop+1, len(c.insts))
+		if check >= 0 {
+			c.insts[check].y = len(c.insts)
+		}
+		return nil
+	}
+	var splits []int
+	for range n.max - n.min {
+		splits = append(splits, c.emit(regexpInst{op: regexpInstSplit}))
+		if err := c.compile(sub); err != nil {
+			return err
+		}
+	}
+	for _, i := range splits {
+		split(i, i+1, len(c.insts))
+	}
+	return nil
+}
+
+// width returns the minimum and maximum number of characters the node matches.
+// The maximum is negative when it is unbounded.
+func (n *regexpNode) width() (int, int) {
+	const limit = 1 << 30
+	switch n.op {
+	case regexpOpLiteral, regexpOpAnyChar, regexpOpClass:
+		return 1, 1
+	case regexpOpConcat:
+		var lo, hi int
+		for _, n := range n.subs {
+			l, h := n.width()
+			lo = min(lo+l, limit)
+			if hi < 0 || h < 0 || hi+h >= limit {
+				hi = -1
+			} else {
+				hi += h
+			}
+		}
+		return lo, hi
+	case regexpOpAlternate:
+		lo, hi := n.subs[0].width()
+		for _, n := range n.subs[1:] {
+			l, h := n.width()
+			lo = min(lo, l)
+			if hi < 0 || h < 0 {
+				hi = -1
+			} else {
+				hi = max(hi, h)
+			}
+		}
+		return lo, hi
+	case regexpOpCapture, regexpOpAtomic:
+		return n.subs[0].width()
+	case regexpOpRepeat:
+		l, h := n.subs[0].width()
+		lo, hi := min(l*n.min, limit), -1
+		if h == 0 {
+			hi = 0
+		} else if h > 0 && n.max >= 0 && h*n.max < limit {
+			hi = h * n.max
+		}
+		return lo, hi
+	case regexpOpBackref:
+		return 0, -1
+	default:
+		return 0, 0
+	}
+}
+
+// regexpPrefix returns the literal prefix of the pattern to skip the positions
+// where the pattern never matches.
+func regexpPrefix(n *regexpNode) string {
+	var sb strings.Builder
+	subs := []*regexpNode{n}
+	if n.op == regexpOpConcat {
+		subs = n.subs
+	}
+	for _, n := range subs {
+		if n.op != regexpOpLiteral || n.fold {
+			break
+		}
+		sb.WriteRune(n.r)
+	}
+	return sb.String()
+}
+
+// regexpLiteral returns the longest literal string in the concatenation of the
+// pattern, which every match contains, like the literal suffix of x*z.
+func regexpLiteral(n *regexpNode) string {
+	for n.op == regexpOpCapture || n.op == regexpOpAtomic {
+		n = n.subs[0]
+	}
+	subs := []*regexpNode{n}
+	if n.op == regexpOpConcat {
+		subs = n.subs
+	}
+	var literal string
+	var sb strings.Builder
+	for _, n := range append(subs, nil) {
+		if n != nil && n.op == regexpOpLiteral && !n.fold {
+			sb.WriteRune(n.r)
+			continue
+		}
+		if sb.Len() > len(literal) {
+			literal = sb.String()
+		}
+		sb.Reset()
+	}
+	return literal
+}
+
+// regexpFirst returns the nodes matching the first character of the matches,
+// or nil if the first character is not restricted.
+func regexpFirst(n *regexpNode) []*regexpNode {
+	if first, nullable, ok := n.first(); ok && !nullable {
+		return first
+	}
+	return nil
+}
+
+// first returns the nodes which can match the first character, whether the
+// node can match the empty string, and whether the first character can be
+// determined.
+func (n *regexpNode) first() ([]*regexpNode, bool, bool) {
+	switch n.op {
+	case regexpOpEmpty:
+		return nil, true, true
+	case regexpOpLiteral, regexpOpClass:
+		return []*regexpNode{n}, false, true
+	case regexpOpAnyChar:
+		if n.dotall {
+			return nil, false, false
+		}
+		return []*regexpNode{n}, false, true
+	case regexpOpConcat:
+		var first []*regexpNode
+		for _, n := range n.subs {
+			xs, nullable, ok := n.first()
+			if !ok {
+				return nil, false, false
+			}
+			if first = append(first, xs...); !nullable {
+				return first, false, true
+			}
+		}
+		return first, true, true
+	case regexpOpAlternate:
+		var first []*regexpNode
+		var nullable bool
+		for _, n := range n.subs {
+			xs, empty, ok := n.first()
+			if !ok {
+				return nil, false, false
+			}
+			first, nullable = append(first, xs...), nullable || empty
+		}
+		return first, nullable, true
+	case regexpOpCapture, regexpOpAtomic:
+		return n.subs[0].first()
+	case regexpOpRepeat:
+		first, nullable, ok := n.subs[0].first()
+		return first, nullable || n.min == 0, ok
+	case regexpOpAssert, regexpOpLook:
+		return nil, true, true // zero-width, followed by the rest of concatenation
+	default:
+		return nil, false, false
+	}
+}
+
+// matchesFirst reports whether r can be the first character of the matches.
+func (re *backtrackRegexp) matchesFirst(r rune) bool {
+	for _, n := range re.first {
+		switch n.op {
+		case regexpOpLiteral:
+			if r == n.r || n.fold && regexpEqualFold(r, n.r) {
+				return true
+			}
+		case regexpOpAnyChar:
+			if r != '\n' {
+				return true
+			}
+		case regexpOpClass:
+			if n.class.matches(r, n.fold) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type backtrackRegexp struct {
+	pattern   string
+	insts     []regexpInst
+	regcnt    int
+	names     []string
+	prefix    string        // literal prefix of the matches
+	literal   string        // literal string contained in the matches
+	first     []*regexpNode // nodes of the first character of the matches
+	notEmpty  bool
+	longest   bool
+	stepLimit int
+}
+
+func (re *backtrackRegexp) SubexpNames() []string {
+	return re.names
+}
+
+func (re *backtrackRegexp) FindAllStringSubmatchIndex(s string, n int) ([][]int, error) {
+	m := &regexpMatcher{
+		re:      re,
+		input:   s,
+		literal: -1,
+		caps:    make([]int, len(re.names)*2),
+		regs:    make([]int, re.regcnt),
+	}
+	var xs [][]int
+	for pos, prev := 0, -1; (n < 0 || len(xs) < n) && pos <= len(s); {
+		if !m.search(pos) {
+			if m.err != nil {
+				return nil, m.err
+			}
+			break
+		}
+		accept := true
+		if m.caps[1] == pos {
+			// Ignore an empty match right after the previous match.
+			accept = m.caps[0] != prev
+			if _, size := utf8.DecodeRuneInString(s[pos:]); size > 0 {
+				pos += size
+			} else {
+				pos++
+			}
+		} else {
+			pos = m.caps[1]
+		}
+		prev = m.caps[1]
+		if accept {
+			xs = append(xs, slices.Clone(m.caps))
+		}
+	}
+	return xs, nil
+}
+
+type regexpFrameKind int
+
+const (
+	regexpFrameChoice regexpFrameKind = iota
+	regexpFrameCapture
+	regexpFrameRegister
+)
+
+type regexpFrame struct {
+	kind  regexpFrameKind
+	index int // instruction index, capture slot, or register
+	value int // position or the value to restore
+}
+
+type regexpMatcher struct {
+	re      *backtrackRegexp
+	input   string
+	start   int
+	literal int // position of the literal string found, or -1
+	caps    []int
+	regs    []int
+	best    []int
+	stack   []regexpFrame
+	steps   int
+	err     error
+}
+
+func (m *regexpMatcher) search(from int) bool {
+	m.start, m.steps = from, 0
+	if m.re.literal != "" && m.literal < from {
+		i := strings.Index(m.input[from:], m.re.literal)
+		if i < 0 {
+			return false
+		}
+		m.literal = from + i
+	}
+	for pos := from; pos <= len(m.input); {
+		if m.re.prefix != "" {
+			i := strings.Index(m.input[pos:], m.re.prefix)
+			if i < 0 {
+				return false
+			}
+			pos += i
+		} else if m.re.first != nil {
+			i := strings.IndexFunc(m.input[pos:], m.re.matchesFirst)
+			if i < 0 {
+				return false
+			}
+			pos += i
+		}
+		for i := range m.caps {
+			m.caps[i] = -1
+		}
+		m.stack, m.best = m.stack[:0], m.best[:0]
+		if _, ok := m.run(0, pos); ok {
+			return true
+		}
+		if m.err != nil {
+			return false
+		}
+		if len(m.best) > 0 {
+			copy(m.caps, m.best)
+			return true
+		}
+		if pos == len(m.input) {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(m.input[pos:])
+		pos += size
+	}
+	return false
+}
+
+// run executes the instructions from pc at pos, until it reaches a match
+// or a succeed instruction. On failure, the stack is restored to the state
+// when it is called, and the captures are restored.
+func (m *regexpMatcher) run(pc, pos int) (int, bool) {
+	base := len(m.stack)
+	for {
+		inst := &m.re.insts[pc]
+		switch inst.op {
+		case regexpInstChar:
+			if r, size := utf8.DecodeRuneInString(m.input[pos:]); size > 0 &&
+				(r == inst.r || inst.fold && regexpEqualFold(r, inst.r)) {
+				pc, pos = pc+1, pos+size
+				continue
+			}
+		case regexpInstAny:
+			if _, size := utf8.DecodeRuneInString(m.input[pos:]); size > 0 {
+				pc, pos = pc+1, pos+size
+				continue
+			}
+		case regexpInstAnyNotNewline:
+			if r, size := utf8.DecodeRuneInString(m.input[pos:]); size > 0 && r != '\n' {
+				pc, pos = pc+1, pos+size
+				continue
+			}
+		case regexpInstClass:
+			if r, size := utf8.DecodeRuneInString(m.input[pos:]); size > 0 &&
+				inst.class.matches(r, inst.fold) {
+				pc, pos = pc+1, pos+size
+				continue
+			}
+		case regexpInstSplit:
+			m.stack = append(m.stack, regexpFrame{regexpFrameChoice, inst.y, pos})
+			pc = inst.x
+			continue
+		case regexpInstJump:
+			pc = inst.x
+			continue
+		case regexpInstSave:
+			m.stack = append(m.stack, regexpFrame{regexpFrameCapture, inst.x, m.caps[inst.x]})
+			m.caps[inst.x] = pos
+			pc++
+			continue
+		case regexpInstAssert:
+			if m.assert(regexpAssert(inst.x), pos) {
+				pc++
+				continue
+			}
+		case regexpInstBackref:
+			if end, ok := m.backref(inst.x, pos, inst.fold); ok {
+				pc, pos = pc+1, end
+				continue
+			}
+		case regexpInstNullCheckStart:
+			m.stack = append(m.stack, regexpFrame{regexpFrameRegister, inst.x, m.regs[inst.x]})
+			m.regs[inst.x] = pos
+			pc++
+			continue
+		case regexpInstNullCheckEnd:
+			if m.regs[inst.x] == pos {
+				pc = inst.y
+			} else {
+				pc++
+			}
+			continue
+		case regexpInstLook:
+			if m.look(inst, pos) {
+				pc = inst.y
+				continue
+			}
+			if m.err != nil {
+				return 0, false
+			}
+		case regexpInstAtomic:
+			base := len(m.stack)
+			if end, ok := m.run(inst.x, pos); ok {
+				m.discardChoices(base)
+				pc, pos = inst.y, end
+				continue
+			}
+			if m.err != nil {
+				return 0, false
+			}
+		case regexpInstCheckPos:
+			if m.regs[inst.x] == pos {
+				pc++
+				continue
+			}
+		case regexpInstSucceed:
+			return pos, true
+		case regexpInstMatch:
+			if !m.re.notEmpty || pos != m.caps[0] {
+				if !m.re.longest {
+					return pos, true
+				}
+				if len(m.best) == 0 || pos-m.caps[0] > m.best[1]-m.best[0] {
+					m.best = append(m.best[:0], m.caps...)
+				}
+			}
+		}
+		var ok bool
+		if pc, pos, ok = m.backtrack(base); !ok {
+			return 0, false
+		}
+	}
+}
+
+// backtrack pops the stack until a choice point above base, restoring the
+// captures and registers.
+func (m *regexpMatcher) backtrack(base int) (int, int, bool) {
+	for len(m.stack) > base {
+		f := m.stack[len(m.stack)-1]
+		m.stack = m.stack[:len(m.stack)-1]
+		switch f.kind {
+		case regexpFrameChoice:
+			if m.steps++; m.steps > m.re.stepLimit {
+				m.err = fmt.Errorf("regular expression %q exceeded the step limit", m.re.pattern)
+				return 0, 0, false
+			}
+			return f.index, f.value, true
+		case regexpFrameCapture:
+			m.caps[f.index] = f.value
+		case regexpFrameRegister:
+			m.regs[f.index] = f.value
+		}
+	}
+	return 0, 0, false
+}
+
+// discardChoices removes the choice points above base to commit the match of
+// an atomic group or a look-around assertion, keeping the frames to restore
+// the captures on backtracking.
+func (m *regexpMatcher) discardChoices(base int) {
+	frames := slices.DeleteFunc(m.stack[base:], func(f regexpFrame) bool {
+		return f.kind == regexpFrameChoice
+	})
+	m.stack = m.stack[:base+len(frames)]
+}
+
+// unwind pops the stack until base, restoring the captures and registers.
+func (m *regexpMatcher) unwind(base int) {
+	for len(m.stack) > base {
+		f := m.stack[len(m.stack)-1]
+		m.stack = m.stack[:len(m.stack)-1]
+		switch f.kind {
+		case regexpFrameCapture:
+			m.caps[f.index] = f.value
+		case regexpFrameRegister:
+			m.regs[f.index] = f.value
+		}
+	}
+}
+
+func (m *regexpMatcher) look(inst *regexpInst, pos int) bool {
+	if inst.behind {
+		m.stack = append(m.stack, regexpFrame{regexpFrameRegister, inst.reg, m.regs[inst.reg]})
+		m.regs[inst.reg] = pos
+	}
+	base := len(m.stack)
+	var ok bool
+	if !inst.behind {
+		_, ok = m.run(inst.x, pos)
+	} else {
+		start := pos
+		for i := 0; i < inst.min && start > 0; i++ {
+			_, size := utf8.DecodeLastRuneInString(m.input[:start])
+			start -= size
+		}
+		for i := inst.min; ; i++ {
+			if _, ok = m.run(inst.x, start); ok || m.err != nil || i == inst.max || start == 0 {
+				break
+			}
+			_, size := utf8.DecodeLastRuneInString(m.input[:start])
+			start -= size
+		}
+	}
+	if m.err != nil {
+		return false
+	}
+	if !ok {
+		return inst.negate
+	}
+	if inst.negate {
+		m.unwind(base)
+		return false
+	}
+	m.discardChoices(base)
+	return true
+}
+
+func (m *regexpMatcher) assert(kind regexpAssert, pos int) bool {
+	switch kind {
+	case regexpAssertBeginLine:
+		return pos == 0 || m.input[pos-1] == '\n'
+	case regexpAssertEndLine:
+		return pos == len(m.input) || m.input[pos] == '\n'
+	case regexpAssertBeginText:
+		return pos == 0
+	case regexpAssertEndText:
+		return pos == len(m.input)
+	case regexpAssertEndTextNewline:
+		return pos == len(m.input) || pos == len(m.input)-1 && m.input[pos] == '\n'
+	case regexpAssertWordBoundary, regexpAssertNotWordBoundary:
+		r1, _ := utf8.DecodeLastRuneInString(m.input[:pos])
+		r2, _ := utf8.DecodeRuneInString(m.input[pos:])
+		w1 := pos > 0 && regexpWordClass.contains(r1)
+		w2 := pos < len(m.input) && regexpWordClass.contains(r2)
+		return (w1 != w2) == (kind == regexpAssertWordBoundary)
+	case regexpAssertSearchStart:
+		return pos == m.start
+	default:
+		panic(fmt.Sprintf("unexpected regexp assertion: %d", kind))
+	}
+}
+
+func (m *regexpMatcher) backref(index, pos int, fold bool) (int, bool) {
+	l, r := m.caps[index*2], m.caps[index*2+1]
+	if l < 0 || r < l {
+		return 0, false
+	}
+	s := m.input[l:r]
+	if !fold {
+		if strings.HasPrefix(m.input[pos:], s) {
+			return pos + len(s), true
+		}
+		return 0, false
+	}
+	for _, r1 := range s {
+		r2, size := utf8.DecodeRuneInString(m.input[pos:])
+		if size == 0 || r1 != r2 && !regexpEqualFold(r1, r2) {
+			return 0, false
+		}
+		pos += size
+	}
+	return pos, true
+}
+
+func regexpEqualFold(r1, r2 rune) bool {
+	for r := unicode.SimpleFold(r1); r != r1; r = unicode.SimpleFold(r) {
+		if r == r2 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,872 @@
+package gojq
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type regexpOp int
+
+const (
+	regexpOpEmpty regexpOp = iota
+	regexpOpLiteral
+	regexpOpAnyChar
+	regexpOpClass
+	regexpOpConcat
+	regexpOpAlternate
+	regexpOpCapture
+	regexpOpRepeat
+	regexpOpAssert
+	regexpOpBackref
+	regexpOpLook
+	regexpOpAtomic
+)
+
+type regexpAssert int
+
+const (
+	regexpAssertBeginLine regexpAssert = iota
+	regexpAssertEndLine
+	regexpAssertBeginText
+	regexpAssertEndText
+	regexpAssertEndTextNewline
+	regexpAssertWordBoundary
+	regexpAssertNotWordBoundary
+	regexpAssertSearchStart
+)
+
+const regexpMaxRepeat = 100000
+
+type regexpNode struct {
+	op         regexpOp
+	r          rune
+	class      *regexpClass
+	subs       []*regexpNode
+	min, max   int // repeat count, max < 0 means unlimited
+	index      int // capture index, backreference index
+	assert     regexpAssert
+	name       string // backreference name
+	fold       bool   // literal, class, backreference
+	dotall     bool   // any character
+	lazy       bool   // repeat
+	possessive bool   // repeat
+	negate     bool   // look-around
+	behind     bool   // look-around
+}
+
+type regexpFlags struct {
+	fold      bool // i
+	multiline bool // m (Perl style, ^ and $ match at line boundaries)
+	dotall    bool // s (Perl style, . matches newline)
+	extended  bool // x
+}
+
+type regexpParser struct {
+	src      string
+	pos      int
+	flags    regexpFlags
+	names    []string
+	backrefs []*regexpNode
+}
+
+// parseRegexp parses the pattern in the syntax of Oniguruma (Perl_NT syntax
+// used by jq), and returns the syntax tree and the names of capturing groups.
+func parseRegexp(src string, flags regexpFlags) (*regexpNode, []string, error) {
+	p := &regexpParser{src: src, flags: flags, names: []string{""}}
+	n, err := p.parseAlternate()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.src) {
+		return nil, nil, errors.New("unmatched close parenthesis")
+	}
+	for _, b := range p.backrefs {
+		if b.name != "" {
+			b.index = -1
+			for i, name := range p.names {
+				if name == b.name {
+					b.index = i
+					break
+				}
+			}
+			if b.index < 0 {
+				return nil, nil, fmt.Errorf("undefined name <%s> reference", b.name)
+			}
+		}
+		if b.index <= 0 || b.index >= len(p.names) {
+			return nil, nil, errors.New("invalid backref number/name")
+		}
+	}
+	return n, p.names, nil
+}
+
+func (p *regexpParser) parseAlternate() (*regexpNode, error) {
+	var subs []*regexpNode
+	for {
+		n, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, n)
+		if p.pos >= len(p.src) || p.src[p.pos] != '|' {
+			break
+		}
+		p.pos++
+	}
+	if len(subs) == 1 {
+		return subs[0], nil
+	}
+	return &regexpNode{op: regexpOpAlternate, subs: subs}, nil
+}
+
+func (p *regexpParser) parseConcat() (*regexpNode, error) {
+	var subs []*regexpNode
+	for {
+		p.skipExtended()
+		if p.pos >= len(p.src) || p.src[p.pos] == '|' || p.src[p.pos] == ')' {
+			break
+		}
+		n, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+		if n == nil { // option setting or comment
+			continue
+		}
+		if n, err = p.parseQuantifiers(n); err != nil {
+			return nil, err
+		}
+		subs = append(subs, n)
+	}
+	switch len(subs) {
+	case 0:
+		return &regexpNode{op: regexpOpEmpty}, nil
+	case 1:
+		return subs[0], nil
+	default:
+		return &regexpNode{op: regexpOpConcat, subs: subs}, nil
+	}
+}
+
+func (p *regexpParser) skipExtended() {
+	for p.flags.extended && p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\n', '\v', '\f', '\r':
+			p.pos++
+		case '#':
+			if i := strings.IndexByte(p.src[p.pos:], '\n'); i >= 0 {
+				p.pos += i + 1
+			} else {
+				p.pos = len(p.src)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *regexpParser) parseQuantifiers(n *regexpNode) (*regexpNode, error) {
+	for {
+		p.skipExtended()
+		if p.pos >= len(p.src) {
+			return n, nil
+		}
+		var min, max int
+		switch p.src[p.pos] {
+		case '*':
+			min, max = 0, -1
+			p.pos++
+		case '+':
+			min, max = 1, -1
+			p.pos++
+		case '?':
+			min, max = 0, 1
+			p.pos++
+		case '{':
+			var ok bool
+			var err error
+			if min, max, ok, err = p.parseRange(); err != nil {
+				return nil, err
+			} else if !ok {
+				return n, nil
+			}
+		default:
+			return n, nil
+		}
+		if n.op == regexpOpAssert || n.op == regexpOpLook {
+			return nil, errors.New("target of repeat operator is invalid")
+		}
+		n = &regexpNode{op: regexpOpRepeat, subs: []*regexpNode{n}, min: min, max: max}
+		if p.pos < len(p.src) {
+			switch p.src[p.pos] {
+			case '?':
+				n.lazy = true
+				p.pos++
+			case '+':
+				n.possessive = true
+				p.pos++
+			}
+		}
+	}
+}
+
+// parseRange parses a repeat range like {n}, {n,}, or {n,m}. When the range is
+// not in these forms (including {,m}), the left brace is treated as a literal.
+func (p *regexpParser) parseRange() (min, max int, ok bool, err error) {
+	i := p.pos + 1
+	digits := func() (int, bool) {
+		j := i
+		for i < len(p.src) && '0' <= p.src[i] && p.src[i] <= '9' {
+			i++
+		}
+		if i == j {
+			return 0, false
+		}
+		n, err := strconv.Atoi(p.src[j:i])
+		if err != nil || n > regexpMaxRepeat {
+			n = regexpMaxRepeat + 1
+		}
+		return n, true
+	}
+	if min, ok = digits(); !ok {
+		return 0, 0, false, nil
+	}
+	max = min
+	if i < len(p.src) && p.src[i] == ',' {
+		i++
+		if max, ok = digits(); !ok {
+			max = -1
+		}
+	}
+	if i >= len(p.src) || p.src[i] != '}' {
+		return 0, 0, false, nil
+	}
+	if min > regexpMaxRepeat || max > regexpMaxRepeat {
+		return 0, 0, false, errors.New("too big number for repeat range")
+	}
+	if max >= 0 && min > max {
+		return 0, 0, false, errors.New("upper is smaller than lower in repeat range")
+	}
+	p.pos = i + 1
+	return min, max, true, nil
+}
+
+func (p *regexpParser) parseAtom() (*regexpNode, error) {
+	switch p.src[p.pos] {
+	case '(':
+		return p.parseGroup()
+	case '[':
+		p.pos++
+		class, err := p.parseClass()
+		if err != nil {
+			return nil, err
+		}
+		return &regexpNode{op: regexpOpClass, class: class, fold: p.flags.fold}, nil
+	case '.':
+		p.pos++
+		return &regexpNode{op: regexpOpAnyChar, dotall: p.flags.dotall}, nil
+	case '^':
+		p.pos++
+		if p.flags.multiline {
+			return &regexpNode{op: regexpOpAssert, assert: regexpAssertBeginLine}, nil
+		}
+		return &regexpNode{op: regexpOpAssert, assert: regexpAssertBeginText}, nil
+	case '$':
+		p.pos++
+		if p.flags.multiline {
+			return &regexpNode{op: regexpOpAssert, assert: regexpAssertEndLine}, nil
+		}
+		return &regexpNode{op: regexpOpAssert, assert: regexpAssertEndTextNewline}, nil
+	case '\\':
+		return p.parseEscape()
+	case '*', '+', '?':
+		return nil, errors.New("target of repeat operator is not specified")
+	case '{':
+		pos := p.pos
+		_, _, ok, err := p.parseRange()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos = pos; ok {
+			return nil, errors.New("target of repeat operator is not specified")
+		}
+	}
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	return p.literal(r), nil
+}
+
+func (p *regexpParser) literal(r rune) *regexpNode {
+	return &regexpNode{op: regexpOpLiteral, r: r, fold: p.flags.fold && unicode.SimpleFold(r) != r}
+}
+
+func (p *regexpParser) parseGroup() (*regexpNode, error) {
+	p.pos++ // (
+	if p.pos >= len(p.src) || p.src[p.pos] != '?' {
+		return p.parseCapture("")
+	}
+	p.pos++ // ?
+	if p.pos >= len(p.src) {
+		return nil, errors.New("end pattern in group")
+	}
+	switch c := p.src[p.pos]; c {
+	case ':':
+		p.pos++
+		return p.parseGroupBody()
+	case '=', '!':
+		p.pos++
+		return p.parseLook(c == '!', false)
+	case '>':
+		p.pos++
+		sub, err := p.parseGroupBody()
+		if err != nil {
+			return nil, err
+		}
+		return &regexpNode{op: regexpOpAtomic, subs: []*regexpNode{sub}}, nil
+	case '#':
+		i := strings.IndexByte(p.src[p.pos:], ')')
+		if i < 0 {
+			return nil, errors.New("end pattern in group")
+		}
+		p.pos += i + 1
+		return nil, nil
+	case '<':
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '=' || p.src[p.pos] == '!') {
+			p.pos++
+			return p.parseLook(p.src[p.pos-1] == '!', true)
+		}
+		return p.parseNamedCapture('>')
+	case '\'':
+		p.pos++
+		return p.parseNamedCapture('\'')
+	case 'P':
+		if p.pos+1 < len(p.src) && p.src[p.pos+1] == '<' {
+			p.pos += 2
+			return p.parseNamedCapture('>')
+		}
+	}
+	return p.parseOptions()
+}
+
+func (p *regexpParser) parseGroupBody() (*regexpNode, error) {
+	flags := p.flags
+	n, err := p.parseAlternate()
+	p.flags = flags
+	if err != nil {
+		return nil, err
+	}
+	if p.pos >= len(p.src) {
+		return nil, errors.New("end pattern with unmatched parenthesis")
+	}
+	p.pos++ // )
+	return n, nil
+}
+
+func (p *regexpParser) parseCapture(name string) (*regexpNode, error) {
+	index := len(p.names)
+	p.names = append(p.names, name)
+	sub, err := p.parseGroupBody()
+	if err != nil {
+		return nil, err
+	}
+	return &regexpNode{op: regexpOpCapture, subs: []*regexpNode{sub}, index: index}, nil
+}
+
+func (p *regexpParser) parseNamedCapture(end byte) (*regexpNode, error) {
+	name, err := p.parseName(end)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := strconv.Atoi(name); err == nil || !isRegexpGroupName(name) {
+		return nil, fmt.Errorf("invalid group name <%s>", name)
+	}
+	for _, n := range p.names {
+		if n == name {
+			return nil, fmt.Errorf("multiplex defined name <%s>", name)
+		}
+	}
+	return p.parseCapture(name)
+}
+
+func (p *regexpParser) parseName(end byte) (string, error) {
+	i := strings.IndexByte(p.src[p.pos:], end)
+	if i < 0 {
+		return "", errors.New("invalid group name <>")
+	}
+	name := p.src[p.pos : p.pos+i]
+	if name == "" {
+		return "", errors.New("group name is empty")
+	}
+	p.pos += i + 1
+	return name, nil
+}
+
+func isRegexpGroupName(name string) bool {
+	for i, r := range name {
+		if !(r == '_' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *regexpParser) parseLook(negate, behind bool) (*regexpNode, error) {
+	sub, err := p.parseGroupBody()
+	if err != nil {
+		return nil, err
+	}
+	return &regexpNode{op: regexpOpLook, subs: []*regexpNode{sub}, negate: negate, behind: behind}, nil
+}
+
+// parseOptions parses the option settings like (?i) and (?i-m:...).
+func (p *regexpParser) parseOptions() (*regexpNode, error) {
+	flags, negate := p.flags, false
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; c {
+		case '-':
+			negate = true
+		case 'i':
+			flags.fold = !negate
+		case 'm':
+			flags.multiline = !negate
+		case 's':
+			flags.dotall = !negate
+		case 'x':
+			flags.extended = !negate
+		case ')':
+			p.pos++
+			p.flags = flags
+			return nil, nil
+		case ':':
+			p.pos++
+			saved := p.flags
+			p.flags = flags
+			n, err := p.parseGroupBody()
+			p.flags = saved
+			return n, err
+		default:
+			return nil, errors.New("undefined group option")
+		}
+		p.pos++
+	}
+	return nil, errors.New("end pattern in group")
+}
+
+func (p *regexpParser) parseEscape() (*regexpNode, error) {
+	p.pos++ // \
+	if p.pos >= len(p.src) {
+		return nil, errors.New("end pattern at escape")
+	}
+	switch c := p.src[p.pos]; c {
+	case 'd', 'D', 'w', 'W', 's', 'S', 'h', 'H':
+		p.pos++
+		return &regexpNode{op: regexpOpClass, class: regexpPerlClass(c), fold: p.flags.fold}, nil
+	case 'p', 'P':
+		class, err := p.parseProperty()
+		if err != nil {
+			return nil, err
+		}
+		return &regexpNode{op: regexpOpClass, class: class, fold: p.flags.fold}, nil
+	case 'b', 'B', 'A', 'z', 'Z', 'G':
+		p.pos++
+		return &regexpNode{op: regexpOpAssert, assert: map[byte]regexpAssert{
+			'b': regexpAssertWordBoundary, 'B': regexpAssertNotWordBoundary,
+			'A': regexpAssertBeginText, 'z': regexpAssertEndText,
+			'Z': regexpAssertEndTextNewline, 'G': regexpAssertSearchStart,
+		}[c]}, nil
+	case 'R':
+		p.pos++
+		return &regexpNode{op: regexpOpAtomic, subs: []*regexpNode{{
+			op: regexpOpAlternate, subs: []*regexpNode{
+				{op: regexpOpConcat, subs: []*regexpNode{
+					{op: regexpOpLiteral, r: '\r'}, {op: regexpOpLiteral, r: '\n'},
+				}},
+				{op: regexpOpClass, class: &regexpClass{
+					ranges: []rune{'\n', '\r', 0x85, 0x85, 0x2028, 0x2029},
+				}},
+			},
+		}}}, nil
+	case 'k':
+		p.pos++
+		if p.pos >= len(p.src) || p.src[p.pos] != '<' && p.src[p.pos] != '\'' {
+			return nil, errors.New("invalid backref number/name")
+		}
+		end := byte('>')
+		if p.src[p.pos] == '\'' {
+			end = '\''
+		}
+		p.pos++
+		name, err := p.parseName(end)
+		if err != nil {
+			return nil, err
+		}
+		b := &regexpNode{op: regexpOpBackref, fold: p.flags.fold}
+		if n, err := strconv.Atoi(name); err != nil {
+			b.name = name
+		} else if n < 0 {
+			b.index = len(p.names) + n
+		} else if name[0] != '+' {
+			b.index = n
+		}
+		p.backrefs = append(p.backrefs, b)
+		return b, nil
+	case 'Q':
+		p.pos++
+		s := p.src[p.pos:]
+		if i := strings.Index(s, `\E`); i >= 0 {
+			s = s[:i]
+			p.pos += 2
+		}
+		p.pos += len(s)
+		subs := make([]*regexpNode, 0, len(s))
+		for _, r := range s {
+			subs = append(subs, p.literal(r))
+		}
+		return &regexpNode{op: regexpOpConcat, subs: subs}, nil
+	case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		start := p.pos
+		for p.pos < len(p.src) && '0' <= p.src[p.pos] && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		if n, err := strconv.Atoi(p.src[start:p.pos]); err == nil &&
+			(n <= 9 || n < len(p.names)) {
+			b := &regexpNode{op: regexpOpBackref, index: n, fold: p.flags.fold}
+			p.backrefs = append(p.backrefs, b)
+			return b, nil
+		}
+		if p.pos = start; c >= '8' {
+			return nil, errors.New("invalid backref number/name")
+		}
+	}
+	r, err := p.parseEscapeRune()
+	if err != nil {
+		return nil, err
+	}
+	return p.literal(r), nil
+}
+
+// parseEscapeRune parses an escape sequence of a character. The position
+// should be just after the backslash.
+func (p *regexpParser) parseEscapeRune() (rune, error) {
+	c := p.src[p.pos]
+	p.pos++
+	switch c {
+	case 't':
+		return '\t', nil
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case 'f':
+		return '\f', nil
+	case 'v':
+		return '\v', nil
+	case 'a':
+		return '\a', nil
+	case 'e':
+		return 0x1b, nil
+	case 'c':
+		if p.pos >= len(p.src) {
+			return 0, errors.New("end pattern at control")
+		}
+		p.pos++
+		return rune(p.src[p.pos-1] & 0x1f), nil
+	case 'x':
+		if p.pos < len(p.src) && p.src[p.pos] == '{' {
+			i := strings.IndexByte(p.src[p.pos:], '}')
+			if i < 0 {
+				return 0, errors.New("invalid code point value")
+			}
+			n, err := strconv.ParseUint(p.src[p.pos+1:p.pos+i], 16, 32)
+			if err != nil || i > 9 {
+				return 0, errors.New("too big wide-char value")
+			}
+			p.pos += i + 1
+			return regexpCodePoint(n)
+		}
+		return p.parseDigits(16, 2)
+	case 'u':
+		return p.parseDigits(16, 4)
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		p.pos--
+		return p.parseDigits(8, 3)
+	default:
+		r, size := utf8.DecodeRuneInString(p.src[p.pos-1:])
+		p.pos += size - 1
+		return r, nil
+	}
+}
+
+func (p *regexpParser) parseDigits(base, max int) (rune, error) {
+	var n uint64
+	i := 0
+	for ; i < max && p.pos < len(p.src); i++ {
+		d, err := strconv.ParseUint(p.src[p.pos:p.pos+1], base, 8)
+		if err != nil {
+			break
+		}
+		n = n*uint64(base) + d
+		p.pos++
+	}
+	if i == 0 || base == 16 && max == 4 && i < max {
+		return 0, errors.New("too short digits")
+	}
+	return regexpCodePoint(n)
+}
+
+func regexpCodePoint(n uint64) (rune, error) {
+	if n > unicode.MaxRune {
+		return 0, errors.New("too big wide-char value")
+	}
+	if r := rune(n); utf8.ValidRune(r) {
+		return r, nil
+	}
+	return 0, errors.New("invalid code point value")
+}
+
+type regexpClass struct {
+	negate bool
+	ranges []rune // pairs of lower and upper bounds
+	tables []*unicode.RangeTable
+	subs   []*regexpClass
+	and    *regexpClass // intersection by &&
+}
+
+func (c *regexpClass) matches(r rune, fold bool) bool {
+	if c.contains(r) {
+		return !c.negate
+	}
+	if fold {
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if c.contains(f) {
+				return !c.negate
+			}
+		}
+	}
+	return c.negate
+}
+
+func (c *regexpClass) contains(r rune) bool {
+	if c.and != nil {
+		if !c.and.matches(r, false) {
+			return false
+		}
+		if len(c.ranges) == 0 && len(c.tables) == 0 && len(c.subs) == 0 {
+			return true
+		}
+	}
+	for i := 0; i < len(c.ranges); i += 2 {
+		if c.ranges[i] <= r && r <= c.ranges[i+1] {
+			return true
+		}
+	}
+	for _, t := range c.tables {
+		if unicode.Is(t, r) {
+			return true
+		}
+	}
+	for _, s := range c.subs {
+		if s.matches(r, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClass parses a character class. The position should be just after the
+// left bracket.
+func (p *regexpParser) parseClass() (*regexpClass, error) {
+	c := &regexpClass{}
+	if p.pos < len(p.src) && p.src[p.pos] == '^' {
+		c.negate = true
+		p.pos++
+	}
+	return c, p.parseClassItems(c)
+}
+
+func (p *regexpParser) parseClassItems(c *regexpClass) error {
+	for first := true; ; first = false {
+		if p.pos >= len(p.src) {
+			return errors.New("premature end of char-class")
+		}
+		if p.src[p.pos] == ']' && !first {
+			p.pos++
+			return nil
+		}
+		if strings.HasPrefix(p.src[p.pos:], "&&") {
+			p.pos += 2
+			c.and = &regexpClass{}
+			return p.parseClassItems(c.and)
+		}
+		lo, sub, err := p.parseClassAtom()
+		if err != nil {
+			return err
+		}
+		if sub != nil {
+			c.subs = append(c.subs, sub)
+			continue
+		}
+		hi := lo
+		if p.pos+1 < len(p.src) && p.src[p.pos] == '-' && p.src[p.pos+1] != ']' {
+			p.pos++
+			if hi, sub, err = p.parseClassAtom(); err != nil {
+				return err
+			} else if sub != nil {
+				return errors.New("char-class value at end of range")
+			} else if hi < lo {
+				return errors.New("empty range in char class")
+			}
+		}
+		c.ranges = append(c.ranges, lo, hi)
+	}
+}
+
+// parseClassAtom parses a character or a nested class in a character class.
+func (p *regexpParser) parseClassAtom() (rune, *regexpClass, error) {
+	switch p.src[p.pos] {
+	case '[':
+		if strings.HasPrefix(p.src[p.pos:], "[:") {
+			if i := strings.Index(p.src[p.pos:], ":]"); i > 0 {
+				name, negate := p.src[p.pos+2:p.pos+i], false
+				if strings.HasPrefix(name, "^") {
+					name, negate = name[1:], true
+				}
+				class, ok := regexpPosixClasses[name]
+				if !ok {
+					return 0, nil, errors.New("invalid POSIX bracket type")
+				}
+				p.pos += i + 2
+				return 0, &regexpClass{negate: negate, subs: []*regexpClass{class}}, nil
+			}
+		}
+		p.pos++
+		class, err := p.parseClass()
+		return 0, class, err
+	case '\\':
+		p.pos++
+		if p.pos >= len(p.src) {
+			return 0, nil, errors.New("end pattern at escape")
+		}
+		switch c := p.src[p.pos]; c {
+		case 'd', 'D', 'w', 'W', 's', 'S', 'h', 'H':
+			p.pos++
+			return 0, regexpPerlClass(c), nil
+		case 'p', 'P':
+			class, err := p.parseProperty()
+			return 0, class, err
+		case 'b':
+			p.pos++
+			return '\b', nil, nil
+		}
+		r, err := p.parseEscapeRune()
+		return r, nil, err
+	default:
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+		return r, nil, nil
+	}
+}
+
+// parseProperty parses a character property like \p{Greek}, \P{Lu}, and
+// \p{^Alpha}. The position should be at p or P.
+func (p *regexpParser) parseProperty() (*regexpClass, error) {
+	negate := p.src[p.pos] == 'P'
+	p.pos++
+	if p.pos >= len(p.src) || p.src[p.pos] != '{' {
+		return nil, errors.New("invalid character property name {}")
+	}
+	i := strings.IndexByte(p.src[p.pos:], '}')
+	if i < 0 {
+		return nil, errors.New("invalid character property name {}")
+	}
+	name := p.src[p.pos+1 : p.pos+i]
+	p.pos += i + 1
+	if strings.HasPrefix(name, "^") {
+		name, negate = name[1:], !negate
+	}
+	class := regexpProperty(name)
+	if class == nil {
+		return nil, fmt.Errorf("invalid character property name {%s}", name)
+	}
+	if negate {
+		class = &regexpClass{negate: true, subs: []*regexpClass{class}}
+	}
+	return class, nil
+}
+
+func regexpProperty(name string) *regexpClass {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(s))
+	}
+	name = normalize(name)
+	if name == "any" {
+		return &regexpClass{ranges: []rune{0, unicode.MaxRune}}
+	}
+	for n, class := range regexpPosixClasses {
+		if n == name {
+			return class
+		}
+	}
+	for _, tables := range []map[string]*unicode.RangeTable{
+		unicode.Categories, unicode.Scripts, unicode.Properties,
+	} {
+		for n, table := range tables {
+			if normalize(n) == name {
+				return &regexpClass{tables: []*unicode.RangeTable{table}}
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	regexpDigitClass = &regexpClass{tables: []*unicode.RangeTable{unicode.Nd}}
+	regexpWordClass  = &regexpClass{
+		tables: []*unicode.RangeTable{unicode.L, unicode.M, unicode.Nd, unicode.Pc},
+	}
+	regexpSpaceClass = &regexpClass{tables: []*unicode.RangeTable{unicode.White_Space}}
+	regexpHexClass   = &regexpClass{ranges: []rune{'0', '9', 'A', 'F', 'a', 'f'}}
+)
+
+func regexpPerlClass(c byte) *regexpClass {
+	var class *regexpClass
+	switch c | 0x20 {
+	case 'd':
+		class = regexpDigitClass
+	case 'w':
+		class = regexpWordClass
+	case 's':
+		class = regexpSpaceClass
+	case 'h':
+		class = regexpHexClass
+	}
+	if c&0x20 == 0 {
+		class = &regexpClass{negate: true, subs: []*regexpClass{class}}
+	}
+	return class
+}
+
+var regexpPosixClasses = map[string]*regexpClass{
+	"alnum": {tables: []*unicode.RangeTable{unicode.L, unicode.M, unicode.Nd}},
+	"alpha": {tables: []*unicode.RangeTable{unicode.L, unicode.M}},
+	"ascii": {ranges: []rune{0, 0x7f}},
+	"blank": {ranges: []rune{'\t', '\t'}, tables: []*unicode.RangeTable{unicode.Zs}},
+	"cntrl": {tables: []*unicode.RangeTable{unicode.Cc}},
+	"digit": regexpDigitClass,
+	"graph": {tables: []*unicode.RangeTable{unicode.L, unicode.M, unicode.N, unicode.P, unicode.S}},
+	"lower": {tables: []*unicode.RangeTable{unicode.Ll}},
+	"print": {tables: []*unicode.RangeTable{unicode.L, unicode.M, unicode.N, unicode.P, unicode.S, unicode.Zs}},
+	"punct": {
+		ranges: []rune{'$', '$', '+', '+', '<', '>', '^', '^', '`', '`', '|', '|', '~', '~'},
+		tables: []*unicode.RangeTable{unicode.P},
+	},
+	"space":  regexpSpaceClass,
+	"upper":  {tables: []*unicode.RangeTable{unicode.Lu}},
+	"word":   regexpWordClass,
+	"xdigit": regexpHexClass,
+}
@@ -0,0 +1,257 @@
+package gojq
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// linearRegexp is the regular expression without the features which require
+// backtracking, which is matched by the regexp package of the standard library
+// in linear time. The end-of-text assertion allowing a trailing newline and
+// the word boundary assertions (which consider Unicode word characters) are
+// only compatible for some inputs, so the backtracking engine is used for the
+// other inputs.
+type linearRegexp struct {
+	re           *regexp.Regexp
+	backtrack    *backtrackRegexp
+	endNewline   bool
+	wordBoundary bool
+}
+
+// newLinearRegexp returns a *linearRegexp when the syntax tree can be matched
+// by the regexp package, or nil otherwise.
+func newLinearRegexp(n *regexpNode, re *backtrackRegexp) *linearRegexp {
+	if re.notEmpty {
+		return nil
+	}
+	l := &linearRegexp{backtrack: re}
+	s := l.convert(n)
+	if s == nil {
+		return nil
+	}
+	r, err := regexp.Compile(s.String())
+	if err != nil || r.NumSubexp() != len(re.names)-1 {
+		return nil
+	}
+	if re.longest {
+		r.Longest()
+	}
+	l.re = r
+	return l
+}
+
+func (l *linearRegexp) SubexpNames() []string {
+	return l.backtrack.names
+}
+
+func (l *linearRegexp) FindAllStringSubmatchIndex(s string, n int) ([][]int, error) {
+	if l.endNewline && strings.HasSuffix(s, "\n") ||
+		l.wordBoundary && !isASCII(s) {
+		return l.backtrack.FindAllStringSubmatchIndex(s, n)
+	}
+	return l.re.FindAllStringSubmatchIndex(s, n), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// convert converts the syntax tree to that of the regexp/syntax package. The
+// capturing groups are converted without names, since the names allowed in
+// the regexp package are more restrictive.
+func (l *linearRegexp) convert(n *regexpNode) *syntax.Regexp {
+	switch n.op {
+	case regexpOpEmpty:
+		return &syntax.Regexp{Op: syntax.OpEmptyMatch}
+	case regexpOpLiteral:
+		s := &syntax.Regexp{Op: syntax.OpLiteral, Rune: []rune{n.r}}
+		if n.fold {
+			s.Flags = syntax.FoldCase
+		}
+		return s
+	case regexpOpAnyChar:
+		if n.dotall {
+			return &syntax.Regexp{Op: syntax.OpAnyChar}
+		}
+		return &syntax.Regexp{Op: syntax.OpAnyCharNotNL}
+	case regexpOpClass:
+		rs := n.class.runeRanges(n.fold)
+		if len(rs) == 0 {
+			return &syntax.Regexp{Op: syntax.OpNoMatch}
+		}
+		return &syntax.Regexp{Op: syntax.OpCharClass, Rune: rs}
+	case regexpOpConcat, regexpOpAlternate:
+		s := &syntax.Regexp{Op: syntax.OpConcat}
+		if n.op == regexpOpAlternate {
+			s.Op = syntax.OpAlternate
+		}
+		for _, n := range n.subs {
+			sub := l.convert(n)
+			if sub == nil {
+				return nil
+			}
+			s.Sub = append(s.Sub, sub)
+		}
+		return s
+	case regexpOpCapture:
+		sub := l.convert(n.subs[0])
+		if sub == nil {
+			return nil
+		}
+		return &syntax.Regexp{Op: syntax.OpCapture, Cap: n.index, Sub: []*syntax.Regexp{sub}}
+	case regexpOpRepeat:
+		if n.possessive {
+			return nil
+		}
+		if lo, _ := n.subs[0].width(); lo == 0 && n.max < 0 {
+			return nil // captures of empty iterations differ
+		}
+		sub := l.convert(n.subs[0])
+		if sub == nil {
+			return nil
+		}
+		s := &syntax.Regexp{Op: syntax.OpRepeat, Min: n.min, Max: n.max, Sub: []*syntax.Regexp{sub}}
+		switch {
+		case n.min == 0 && n.max < 0:
+			s.Op = syntax.OpStar
+		case n.min == 1 && n.max < 0:
+			s.Op = syntax.OpPlus
+		case n.min == 0 && n.max == 1:
+			s.Op = syntax.OpQuest
+		}
+		if n.lazy {
+			s.Flags = syntax.NonGreedy
+		}
+		return s
+	case regexpOpAssert:
+		switch n.assert {
+		case regexpAssertBeginLine:
+			return &syntax.Regexp{Op: syntax.OpBeginLine}
+		case regexpAssertEndLine:
+			return &syntax.Regexp{Op: syntax.OpEndLine}
+		case regexpAssertBeginText:
+			return &syntax.Regexp{Op: syntax.OpBeginText}
+		case regexpAssertEndText:
+			return &syntax.Regexp{Op: syntax.OpEndText}
+		case regexpAssertEndTextNewline:
+			l.endNewline = true
+			return &syntax.Regexp{Op: syntax.OpEndText}
+		case regexpAssertWordBoundary:
+			l.wordBoundary = true
+			return &syntax.Regexp{Op: syntax.OpWordBoundary}
+		case regexpAssertNotWordBoundary:
+			l.wordBoundary = true
+			return &syntax.Regexp{Op: syntax.OpNoWordBoundary}
+		}
+	}
+	return nil
+}
+
+// regexpMaxFoldRune is the maximum rune which has case folding equivalents.
+const regexpMaxFoldRune = 0x1E943
+
+// runeRanges returns the sorted pairs of lower and upper bounds of the runes
+// matched by the class.
+func (c *regexpClass) runeRanges(fold bool) []rune {
+	rs := slices.Clone(c.ranges)
+	for _, t := range c.tables {
+		for _, r := range t.R16 {
+			rs = appendStrideRanges(rs, rune(r.Lo), rune(r.Hi), rune(r.Stride))
+		}
+		for _, r := range t.R32 {
+			rs = appendStrideRanges(rs, rune(r.Lo), rune(r.Hi), rune(r.Stride))
+		}
+	}
+	for _, s := range c.subs {
+		rs = append(rs, s.runeRanges(false)...)
+	}
+	rs = normalizeRuneRanges(rs)
+	if c.and != nil {
+		and := c.and.runeRanges(false)
+		if len(c.ranges) == 0 && len(c.tables) == 0 && len(c.subs) == 0 {
+			rs = and
+		} else {
+			rs = intersectRuneRanges(rs, and)
+		}
+	}
+	if fold {
+		for i, n := 0, len(rs); i < n; i += 2 {
+			for r := rs[i]; r <= min(rs[i+1], regexpMaxFoldRune); r++ {
+				for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+					rs = append(rs, f, f)
+				}
+			}
+		}
+		rs = normalizeRuneRanges(rs)
+	}
+	if c.negate {
+		rs = negateRuneRanges(rs)
+	}
+	return rs
+}
+
+func appendStrideRanges(rs []rune, lo, hi, stride rune) []rune {
+	if stride == 1 {
+		return append(rs, lo, hi)
+	}
+	for r := lo; r <= hi; r += stride {
+		rs = append(rs, r, r)
+	}
+	return rs
+}
+
+func normalizeRuneRanges(rs []rune) []rune {
+	pairs := make([][2]rune, 0, len(rs)/2)
+	for i := 0; i < len(rs); i += 2 {
+		pairs = append(pairs, [2]rune{rs[i], rs[i+1]})
+	}
+	slices.SortFunc(pairs, func(x, y [2]rune) int { return int(x[0] - y[0]) })
+	rs = rs[:0]
+	for _, p := range pairs {
+		if n := len(rs); n > 0 && p[0] <= rs[n-1]+1 {
+			rs[n-1] = max(rs[n-1], p[1])
+		} else {
+			rs = append(rs, p[0], p[1])
+		}
+	}
+	return rs
+}
+
+func intersectRuneRanges(xs, ys []rune) []rune {
+	var rs []rune
+	for i, j := 0, 0; i < len(xs) && j < len(ys); {
+		if lo, hi := max(xs[i], ys[j]), min(xs[i+1], ys[j+1]); lo <= hi {
+			rs = append(rs, lo, hi)
+		}
+		if xs[i+1] < ys[j+1] {
+			i += 2
+		} else {
+			j += 2
+		}
+	}
+	return rs
+}
+
+func negateRuneRanges(rs []rune) []rune {
+	var xs []rune
+	lo := rune(0)
+	for i := 0; i < len(rs); i += 2 {
+		if lo < rs[i] {
+			xs = append(xs, lo, rs[i]-1)
+		}
+		lo = rs[i+1] + 1
+	}
+	if lo <= unicode.MaxRune {
+		xs = append(xs, lo, unicode.MaxRune)
+	}
+	return xs
+}
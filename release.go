@@ -8,6 +8,8 @@ func (*compiler) appendCodeInfo(any) {}
 
 func (*compiler) deleteCodeInfo(string) {}
 
+func (*compiler) copyCodeInfos(*compiler, int, int, int) {}
+
 func (*env) debugCodes() {}
 
 func (*env) debugState(int, bool) {}
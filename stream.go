@@ -0,0 +1,365 @@
+package gojq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+)
+
+// streamPath returns the leading path of the query, which consists of object
+// keys (string), array indices (int), and array iterations (nil). The path is
+// taken from the leftmost term of the pipes, and stops at the first suffix
+// which cannot be evaluated against the token stream, like slices and optional
+// suffixes. Note that the iteration over objects is not included since gojq
+// iterates the values in the order of the sorted keys.
+func streamPath(q *Query) []any {
+	for q.Op == OpPipe && q.Patterns == nil {
+		q = q.Left
+	}
+	if q.Op != 0 || q.Term == nil {
+		return nil
+	}
+	var path []any
+	switch q.Term.Type {
+	case TermTypeIndex:
+		if path = appendStreamPath(path, q.Term.Index); path == nil {
+			return nil
+		}
+	case TermTypeIdentity:
+	default:
+		return nil
+	}
+	for i, s := range q.Term.SuffixList {
+		if s.Iter {
+			path = append(path, nil)
+		} else if xs := appendStreamPath(path, s.Index); xs != nil {
+			path = xs
+		} else {
+			// the index queries are evaluated against the input of the term
+			for _, s := range q.Term.SuffixList[i:] {
+				if s.Index != nil && s.Index.toIndexKey() == nil {
+					return nil
+				}
+			}
+			break
+		}
+	}
+	return path
+}
+
+func appendStreamPath(path []any, e *Index) []any {
+	if e == nil {
+		return nil
+	}
+	switch k := e.toIndexKey().(type) {
+	case string:
+		return append(path, k)
+	case int:
+		if k >= 0 {
+			return append(path, k)
+		}
+	}
+	return nil
+}
+
+// Streamable reports whether [*Code.RunReader] and [*Code.RunDecoder] can evaluate the code without
+// decoding the whole JSON values. This is true when the query starts with a
+// path of object keys, array indices, and array iterations (like .items[].id)
+// and does not use input or inputs functions.
+func (c *Code) Streamable() bool {
+	return len(c.path) > 0 && !c.usesInput
+}
+
+// RunReader runs the code against each JSON value read from the reader, and
+// returns a result iterator. When the code is streamable (refer to
+// [*Code.Streamable]), the JSON values are read as a token stream, and only
+// the subtrees matching the leading path of the query are decoded. For
+// example, .[] | select(.x > 1) decodes each element of the array one by one,
+// so the memory usage does not depend on the size of the array. Since the last
+// value wins on duplicate object keys, the value of an object key in the path
+// (like .items of .items[]) is kept as raw bytes until the end of the object,
+// and then evaluated in the same way. Otherwise, each JSON value is decoded
+// entirely before the evaluation.
+//
+// The values are decoded by [Decoder], so the integers are decoded as int or
+// *big.Int and other numbers as [json.Number]. The evaluation against each JSON
+// value stops at the first error. An error on decoding JSON, which is emitted
+// as is and ends the iteration, can be emitted after some results of the JSON
+// value since the value is not decoded entirely in advance. When a [*HaltError]
+// is emitted, the iterator stops reading the reader and ends.
+func (c *Code) RunReader(ctx context.Context, r io.Reader, values ...any) Iter {
+	return c.RunDecoder(ctx, NewDecoder(r), values...)
+}
+
+// RunDecoder is like [*Code.RunReader], but reads the JSON values with the
+// decoder, which can be configured like [*Decoder.AllowNonFinite].
+func (c *Code) RunDecoder(ctx context.Context, dec *Decoder, values ...any) Iter {
+	var path []any
+	if c.Streamable() {
+		path = c.path
+	}
+	return &readerIter{ctx: ctx, code: c, values: values, dec: dec, path: path}
+}
+
+type readerIter struct {
+	ctx    context.Context
+	code   *Code
+	values []any
+	dec    *Decoder
+	path   []any
+	frames []*readerFrame
+	base   int // number of the frames of the enclosing readerIter
+	iter   Iter
+	skip   bool
+}
+
+// readerFrame is the state of the array or object in the token stream, which
+// the path step of the same depth is applied to.
+type readerFrame struct {
+	key   any    // the key or index of the current value
+	raw   []byte // the last value of the object key
+	index int
+	found bool
+}
+
+func (iter *readerIter) Next() (any, bool) {
+	for {
+		if iter.iter != nil {
+			if v, ok := iter.iter.Next(); ok {
+				if err, ok := v.(error); ok {
+					iter.iter = nil
+					if _, ok := err.(*HaltError); ok {
+						iter.dec = nil
+					} else {
+						iter.skip = true
+					}
+				}
+				return v, true
+			}
+			iter.iter = nil
+		}
+		if iter.dec == nil {
+			return nil, false
+		}
+		if err := iter.next(); err != nil {
+			iter.dec = nil
+			if err == io.EOF {
+				return nil, false
+			}
+			return err, true
+		}
+	}
+}
+
+func (iter *readerIter) next() error {
+	if err := iter.ctx.Err(); err != nil {
+		return err
+	}
+	if iter.skip {
+		iter.skip = false
+		return iter.skipFrames()
+	}
+	if len(iter.frames) == iter.base {
+		return iter.descend()
+	}
+	err := iter.nextFrame()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (iter *readerIter) nextFrame() error {
+	f := iter.frames[len(iter.frames)-1]
+	step := iter.path[len(iter.frames)-1]
+	if !iter.dec.More() {
+		if _, err := iter.dec.Token(); err != nil {
+			return err
+		}
+		iter.frames = iter.frames[:len(iter.frames)-1]
+		switch step.(type) {
+		case string:
+			if f.raw != nil {
+				iter.descendRaw(f)
+			} else {
+				iter.run(map[string]any{})
+			}
+		case int:
+			if !f.found {
+				iter.run([]any{})
+			}
+		}
+		return nil
+	}
+	switch step := step.(type) {
+	case string:
+		t, err := iter.dec.Token()
+		if err != nil {
+			return err
+		}
+		if t == step {
+			f.key = step
+			f.raw, err = iter.dec.DecodeRaw()
+			return err
+		}
+	case int:
+		f.index++
+		if f.index-1 == step {
+			f.key, f.found = step, true
+			return iter.descend()
+		}
+	default:
+		f.key = f.index
+		f.index++
+		return iter.descend()
+	}
+	return iter.skipValue()
+}
+
+// descend evaluates the value at the current position of the token stream. If
+// the path step of the depth can be applied to the value, pushes a new frame.
+// Otherwise, decodes the value and runs the code against it.
+func (iter *readerIter) descend() error {
+	if len(iter.frames) == len(iter.path) {
+		v, err := iter.dec.Decode()
+		if err != nil {
+			return err
+		}
+		iter.run(v)
+		return nil
+	}
+	t, err := iter.dec.Token()
+	if err != nil {
+		return err
+	}
+	var v any
+	switch t {
+	case json.Delim('{'):
+		if _, ok := iter.path[len(iter.frames)].(string); ok {
+			iter.frames = append(iter.frames, &readerFrame{})
+			return nil
+		}
+		if v, err = iter.decodeObject(); err != nil {
+			return err
+		}
+	case json.Delim('['):
+		if _, ok := iter.path[len(iter.frames)].(string); !ok {
+			iter.frames = append(iter.frames, &readerFrame{})
+			return nil
+		}
+		if v, err = iter.decodeArray(); err != nil {
+			return err
+		}
+	default:
+		v = t
+	}
+	iter.run(v)
+	return nil
+}
+
+// descendRaw evaluates the last value of the object key of the frame, which is
+// read after the end of the object, by the readerIter on the raw bytes.
+func (iter *readerIter) descendRaw(f *readerFrame) {
+	dec := NewDecoder(bytes.NewReader(f.raw))
+	dec.nonFinite = iter.dec.nonFinite
+	iter.iter = &readerIter{
+		ctx: iter.ctx, code: iter.code, values: iter.values, dec: dec, path: iter.path,
+		frames: append(slices.Clone(iter.frames), f), base: len(iter.frames) + 1,
+	}
+}
+
+// run runs the code against the value at the current depth. The value is
+// wrapped by the keys and indices of the frames, so that the code, which
+// starts with the path, evaluates the value as in the original JSON value.
+func (iter *readerIter) run(v any) {
+	for i := len(iter.frames) - 1; i >= 0; i-- {
+		switch k := iter.frames[i].key.(type) {
+		case string:
+			v = map[string]any{k: v}
+		case int:
+			if _, ok := iter.path[i].(int); ok {
+				xs := make([]any, k+1)
+				xs[k] = v
+				v = xs
+			} else {
+				v = []any{v}
+			}
+		}
+	}
+	iter.iter = iter.code.RunWithContext(iter.ctx, v, iter.values...)
+}
+
+func (iter *readerIter) decodeObject() (any, error) {
+	v := map[string]any{}
+	for iter.dec.More() {
+		t, err := iter.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		x, err := iter.dec.Decode()
+		if err != nil {
+			return nil, err
+		}
+		v[t.(string)] = x
+	}
+	if _, err := iter.dec.Token(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (iter *readerIter) decodeArray() (any, error) {
+	v := []any{}
+	for iter.dec.More() {
+		x, err := iter.dec.Decode()
+		if err != nil {
+			return nil, err
+		}
+		v = append(v, x)
+	}
+	if _, err := iter.dec.Token(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (iter *readerIter) skipValue() error {
+	for depth := 0; ; {
+		t, err := iter.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// skipFrames skips the rest of the JSON value after an error.
+func (iter *readerIter) skipFrames() error {
+	for depth := len(iter.frames) - iter.base; depth > 0; {
+		t, err := iter.dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	iter.frames = iter.frames[:iter.base]
+	return nil
+}
@@ -0,0 +1,233 @@
+package gojq_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itchyny/gojq"
+)
+
+func ExampleCode_RunReader() {
+	query, err := gojq.Parse(".items[] | select(.x > 1) | .name")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	r := strings.NewReader(`{
+		"items": [
+			{"name": "a", "x": 1},
+			{"name": "b", "x": 2},
+			{"name": "c", "x": 3}
+		]
+	}`)
+	iter := code.RunReader(context.Background(), r)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			log.Fatalln(err)
+		}
+		fmt.Printf("%#v\n", v)
+	}
+
+	// Output:
+	// "b"
+	// "c"
+}
+
+func TestCodeRunReader(t *testing.T) {
+	testCases := []struct {
+		src        string
+		streamable bool
+	}{
+		{`.`, false},
+		{`.[]`, true},
+		{`.a`, true},
+		{`.a.b`, true},
+		{`.a[]`, true},
+		{`.a[].b`, true},
+		{`.a[] | .b`, true},
+		{`.a[1]`, true},
+		{`.[0][]`, true},
+		{`.["a"].b`, true},
+		{`.a[]?`, true},
+		{`.a[1:]`, true},
+		{`.a[] | select(.b > 1) | .c`, true},
+		{`.a[] | error`, true},
+		{`.a[] | if . == 2 then error else . end`, true},
+		{`def f: . * 2; .a[] | f`, true},
+		{`.a | . as $x | $x.b`, true},
+		{`.a[] as $x | $x`, false},
+		{`.a, .b`, false},
+		{`first(.a[])`, false},
+		{`.[-1]`, false},
+		{`.a[] | input`, false},
+	}
+	inputs := `
+		{"a": [1, 2, 3], "b": 4}
+		{"a": {"b": 1, "c": 2}, "b": [5]}
+		{"b": [{"b": 6}], "a": [{"b": 2, "c": 7}, {"b": 1}, {"b": 3, "c": 8}], "c": []}
+		{"a": null}
+		[[1, 2], {"a": [3]}, "a"]
+		{"a": "b"}
+		{"a": [1], "a": {"b": 2}, "b": 3, "a": [{"b": 4}, {"b": 5, "b": 6}]}
+		{"a": {"b": [1], "b": 2}, "a": {"b": 3, "c": 4, "b": [5, 6]}}
+		[]
+		{}
+		1
+		"a"
+		null
+	`
+	for _, tc := range testCases {
+		t.Run(tc.src, func(t *testing.T) {
+			query, err := gojq.Parse(tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := gojq.Compile(query, gojq.WithInputIter(gojq.NewIter[any]()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := code.Streamable(); got != tc.streamable {
+				t.Errorf("expected: %v, got: %v", tc.streamable, got)
+			}
+			var expected []any
+			dec := gojq.NewDecoder(strings.NewReader(inputs))
+			for {
+				v, err := dec.Decode()
+				if err != nil {
+					if err != io.EOF {
+						t.Fatal(err)
+					}
+					break
+				}
+				iter := code.Run(v)
+				for {
+					v, ok := iter.Next()
+					if !ok {
+						break
+					}
+					if err, ok := v.(error); ok {
+						expected = append(expected, err.Error())
+						break
+					}
+					expected = append(expected, v)
+				}
+			}
+			got := collectValues(code.RunReader(context.Background(), strings.NewReader(inputs)))
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected: %v, got: %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestCodeRunReaderError(t *testing.T) {
+	testCases := []struct {
+		src      string
+		input    string
+		expected []any
+		err      string
+	}{
+		{
+			src:      `.[]`,
+			input:    `[1, 2, }`,
+			expected: []any{1, 2},
+			err:      "invalid character '}' looking for beginning of value",
+		},
+		{
+			src:      `.[]`,
+			input:    `[1, 2`,
+			expected: []any{1, 2},
+			err:      "unexpected EOF",
+		},
+		{
+			src:      `.[] | error`,
+			input:    `[1, 2}`,
+			expected: []any{1},
+			err:      "invalid character '}' after array element",
+		},
+		{
+			src:   `.a[]`,
+			input: `{"a": [1, 2, }`,
+			err:   "invalid character '}' looking for beginning of value",
+		},
+		{
+			src:      `.[] | if . == 2 then halt_error else . end`,
+			input:    `[1, 2, 3] [4]`,
+			expected: []any{1, "halt"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.src, func(t *testing.T) {
+			query, err := gojq.Parse(tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := gojq.Compile(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []any
+			var errmsg string
+			iter := code.RunReader(context.Background(), strings.NewReader(tc.input))
+			for {
+				v, ok := iter.Next()
+				if !ok {
+					break
+				}
+				switch err := v.(type) {
+				case *gojq.HaltError:
+					got = append(got, "halt")
+				case interface{ Value() any }:
+					got = append(got, err.Value())
+				case error:
+					if errmsg != "" {
+						t.Fatalf("unexpected error after error: %v", err)
+					}
+					errmsg = err.Error()
+				default:
+					got = append(got, v)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected: %v, got: %v", tc.expected, got)
+			}
+			if errmsg != tc.err {
+				t.Errorf("expected: %v, got: %v", tc.err, errmsg)
+			}
+		})
+	}
+}
+
+func TestCodeRunDecoder(t *testing.T) {
+	query, err := gojq.Parse(`.a[] | isinfinite`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const input = "\xEF\xBB\xBF" + `{"a": [Infinity, 1, -Infinity]} {"a": [NaN]}`
+	dec := gojq.NewDecoder(strings.NewReader(input))
+	dec.AllowNonFinite()
+	got := collectValues(code.RunDecoder(context.Background(), dec))
+	if expected := []any{true, false, true, false}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+	got = collectValues(code.RunReader(context.Background(), strings.NewReader(input)))
+	if expected := []any{"invalid character 'I' looking for beginning of value"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+}
@@ -1,6 +1,7 @@
 package gojq
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"math/big"
@@ -9,10 +10,11 @@ import (
 // TypeOf returns the jq-flavored type name of v.
 //
 // This method is used by built-in type/0 function, and accepts only limited
-// types (nil, bool, int, float64, *big.Int, json.Number, string, []any, and
-// map[string]any).
+// types (nil, bool, int, float64, *big.Int, json.Number, json.RawMessage,
+// string, []any, and map[string]any). The type of json.RawMessage is determined
+// by the first byte, without validating the bytes.
 func TypeOf(v any) string {
-	switch v.(type) {
+	switch v := v.(type) {
 	case nil:
 		return "null"
 	case bool:
@@ -25,7 +27,13 @@ func TypeOf(v any) string {
 		return "array"
 	case map[string]any:
 		return "object"
-	default:
-		panic(fmt.Sprintf("invalid type: %[1]T (%[1]v)", v))
+	case json.RawMessage:
+		// the bytes are not validated, to avoid scanning large values
+		if raw := bytes.TrimSpace(v); len(raw) > 0 {
+			if typ := rawTypeOf(raw); typ != "" {
+				return typ
+			}
+		}
 	}
+	panic(fmt.Sprintf("invalid type: %[1]T (%[1]v)", v))
 }